@@ -59,6 +59,28 @@ func testAcceptance(t *testing.T, when spec.G, it spec.S) {
 			}
 		})
 
+		when("the buildpack order is cyclic", func() {
+			it("creator/should fail with exit code 12", func() {
+				layersDir, err := ioutil.TempDir("", "lifecycle-acceptance-layers")
+				h.AssertNil(t, err)
+				defer os.RemoveAll(layersDir)
+
+				cmd := lifecycleCmd("creator",
+					"-order=order.toml",
+					"-buildpacks=buildpacks",
+					"-app=app",
+					"-layers="+layersDir,
+					"-platform="+layersDir,
+					"some/image",
+				)
+				cmd.Dir = filepath.Join("testdata", "creator")
+
+				_, exitCode, err := h.RunE(cmd)
+				h.AssertError(t, err, "cyclic buildpack order: A@v1 -> B@v1 -> A@v1")
+				h.AssertEq(t, exitCode, 12)
+			})
+		})
+
 		when("version flag is set", func() {
 			for _, tc := range []testCase{
 				{
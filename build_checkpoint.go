@@ -0,0 +1,67 @@
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+const checkpointFile = "build-checkpoint.toml"
+
+// A checkpoint is only written when resuming is enabled, since it would
+// otherwise be left in the exported layers directory by a failed build. The
+// build environment is not recorded: it is rebuilt from the layers of the
+// completed buildpacks.
+type buildCheckpoint struct {
+	Key       string           `toml:"key"`
+	Completed []Buildpack      `toml:"completed"`
+	Processes []launch.Process `toml:"processes"`
+	BOM       []BOMEntry       `toml:"bom"`
+	Slices    []Slice          `toml:"slices"`
+	Plan      BuildPlan        `toml:"plan"`
+}
+
+func (b *Builder) checkpointKey() (string, error) {
+	h := sha256.New()
+	if err := toml.NewEncoder(h).Encode(struct {
+		Group BuildpackGroup `toml:"group"`
+		Plan  BuildPlan      `toml:"plan"`
+	}{b.Group, b.Plan}); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+func (b *Builder) readCheckpoint(layersDir, key string) (*buildCheckpoint, error) {
+	var cp buildCheckpoint
+	if _, err := toml.DecodeFile(filepath.Join(layersDir, checkpointFile), &cp); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "read build checkpoint")
+	}
+	if cp.Key != key {
+		b.Err.Printf("Warning: not resuming build: group or plan changed since the last checkpoint")
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func writeCheckpoint(layersDir string, cp *buildCheckpoint) error {
+	if err := WriteTOML(filepath.Join(layersDir, checkpointFile), cp); err != nil {
+		return errors.Wrap(err, "write build checkpoint")
+	}
+	return nil
+}
+
+func removeCheckpoint(layersDir string) error {
+	if err := os.Remove(filepath.Join(layersDir, checkpointFile)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "remove build checkpoint")
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/buildpacks/lifecycle/internal/procutil"
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+// If no log option is set, the loggers' writers are passed through unwrapped,
+// so that bin/build inherits them as files instead of writing to a pipe.
+type buildLog struct {
+	stdout, stderr io.Writer
+	lines          []*lineWriter
+	file           *os.File
+}
+
+func (b *Builder) openBuildLog(bp Buildpack) (*buildLog, error) {
+	if !b.LogPrefix && !b.LogTimestamps && b.LogDir == "" {
+		return &buildLog{stdout: b.Out.Writer(), stderr: b.Err.Writer()}, nil
+	}
+	stdout := &lineWriter{w: b.Out.Writer(), prefix: b.linePrefix(bp, b.LogPrefix)}
+	stderr := &lineWriter{w: b.Err.Writer(), prefix: b.linePrefix(bp, b.LogPrefix)}
+	l := &buildLog{stdout: stdout, stderr: stderr, lines: []*lineWriter{stdout, stderr}}
+	if b.LogDir == "" {
+		return l, nil
+	}
+	if err := os.MkdirAll(b.LogDir, 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(b.LogDir, launch.EscapeID(bp.ID)+".log"))
+	if err != nil {
+		return nil, err
+	}
+	file := procutil.NewLockedWriter(f)
+	fileOut := &lineWriter{w: file, prefix: b.linePrefix(bp, false)}
+	fileErr := &lineWriter{w: file, prefix: b.linePrefix(bp, false)}
+	l.file = f
+	l.stdout = io.MultiWriter(stdout, fileOut)
+	l.stderr = io.MultiWriter(stderr, fileErr)
+	l.lines = append(l.lines, fileOut, fileErr)
+	return l, nil
+}
+
+func (l *buildLog) Stdout() io.Writer {
+	return l.stdout
+}
+
+func (l *buildLog) Stderr() io.Writer {
+	return l.stderr
+}
+
+// Close writes any partial last lines and closes the log file.
+func (l *buildLog) Close() error {
+	for _, w := range l.lines {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if l.file != nil {
+		return l.file.Close()
+	}
+	return nil
+}
+
+func (b *Builder) linePrefix(bp Buildpack, withID bool) func() string {
+	return func() string {
+		var prefix string
+		if b.LogTimestamps {
+			prefix = time.Now().UTC().Format(time.RFC3339) + " "
+		}
+		if withID {
+			prefix += "[" + bp.String() + "] "
+		}
+		return prefix
+	}
+}
+
+// maxLineLength is the length after which a partial line is written, so that
+// output without newlines does not grow the buffer without bound.
+const maxLineLength = 64 * 1024
+
+// A carriage return also ends a line, so that progress output is not held back.
+type lineWriter struct {
+	w      io.Writer
+	prefix func() string
+	buf    []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexAny(lw.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(lw.w, lw.prefix()+string(lw.buf[:i+1])); err != nil {
+			return 0, err
+		}
+		lw.buf = lw.buf[i+1:]
+	}
+	switch {
+	case len(lw.buf) == 0:
+	case lw.prefix() == "":
+		if _, err := lw.w.Write(lw.buf); err != nil {
+			return 0, err
+		}
+		lw.buf = nil
+	case len(lw.buf) >= maxLineLength:
+		if err := lw.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (lw *lineWriter) Flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(lw.w, lw.prefix()+string(lw.buf)+"\n")
+	lw.buf = nil
+	return err
+}
+
+type buildSummary []buildSummaryEntry
+
+type buildSummaryEntry struct {
+	buildpack Buildpack
+	status    string
+	duration  time.Duration
+}
+
+func (s *buildSummary) add(bp Buildpack, err error, duration time.Duration) {
+	status := "exit 0"
+	switch e := err.(type) {
+	case nil:
+	case *exec.ExitError:
+		if code := e.ExitCode(); code >= 0 {
+			status = fmt.Sprintf("exit %d", code)
+		} else {
+			status = "killed"
+		}
+	default:
+		switch err {
+		case context.DeadlineExceeded:
+			status = "timed out"
+		case context.Canceled:
+			status = "cancelled"
+		default:
+			status = "error"
+		}
+	}
+	*s = append(*s, buildSummaryEntry{buildpack: bp, status: status, duration: duration})
+}
+
+func (s buildSummary) print(out *log.Logger) {
+	maxLength := 0
+	for _, e := range s {
+		if l := len(e.buildpack.String()); l > maxLength {
+			maxLength = l
+		}
+	}
+	f := fmt.Sprintf("%%-%ds  %%-9s  %%s", maxLength)
+
+	out.Printf("======== Build summary ========")
+	for _, e := range s {
+		out.Printf(f, e.buildpack, e.status, e.duration.Round(time.Millisecond))
+	}
+}
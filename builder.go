@@ -1,15 +1,19 @@
 package lifecycle
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
 
+	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/launch"
 )
 
@@ -22,6 +26,16 @@ type Builder struct {
 	Group         BuildpackGroup
 	Plan          BuildPlan
 	Out, Err      *log.Logger
+	Context       context.Context
+	Timeout       time.Duration
+	BuildpackAPI  *api.Version
+	LogPrefix     bool   // prefix each line of buildpack output with the buildpack
+	LogTimestamps bool   // prefix each line of buildpack output with the time
+	LogDir        string // if set, each buildpack's output is also written to <LogDir>/<id>.log
+	LogSummary    bool   // print the exit status and duration of each buildpack after the build
+	LogUsage      bool   // print the resources used by each buildpack, ranked by wall time
+	Resume        bool   // checkpoint after each buildpack and skip the buildpacks completed by a previous build of the same group and plan
+	Logger        Logger // if set, the provenance of each buildpack's env vars is logged at debug level
 }
 
 type BuildEnv interface {
@@ -31,6 +45,10 @@ type BuildEnv interface {
 	List() []string
 }
 
+type provenanceEnv interface {
+	DescribeProvenance(platformDir string, label func(source string) string) ([]string, error)
+}
+
 type Slice struct {
 	Paths []string `tom:"paths"`
 }
@@ -72,12 +90,62 @@ func (b *Builder) Build() (*BuildMetadata, error) {
 	plan := b.Plan
 	var bom []BOMEntry
 	var slices []Slice
+	var summary buildSummary
+	if b.LogSummary {
+		defer func() { summary.print(b.Out) }()
+	}
+	var usage []BuildpackUsage
+	if b.LogUsage {
+		defer func() { b.logUsage(usage) }()
+	}
+
+	checkpoint := &buildCheckpoint{}
+	if b.Resume {
+		key, err := b.checkpointKey()
+		if err != nil {
+			return nil, err
+		}
+		cp, err := b.readCheckpoint(layersDir, key)
+		if err != nil {
+			return nil, err
+		}
+		if cp != nil {
+			b.Out.Printf("Resuming build after %d completed buildpack(s)", len(cp.Completed))
+			for _, bp := range cp.Completed {
+				if err := setupEnv(b.Env, filepath.Join(layersDir, launch.EscapeID(bp.ID))); err != nil {
+					return nil, err
+				}
+			}
+			// the buildpack that failed may have left partial layers
+			if n := len(cp.Completed); n < len(b.Group.Group) {
+				if err := os.RemoveAll(filepath.Join(layersDir, launch.EscapeID(b.Group.Group[n].ID))); err != nil {
+					return nil, err
+				}
+			}
+			procMap.add(cp.Processes)
+			bom = cp.BOM
+			slices = cp.Slices
+			plan = cp.Plan
+			checkpoint = cp
+		} else {
+			checkpoint.Key = key
+			if err := writeCheckpoint(layersDir, checkpoint); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	for _, bp := range b.Group.Group {
+	for i, bp := range b.Group.Group {
+		if i < len(checkpoint.Completed) {
+			continue
+		}
 		bpInfo, err := bp.lookup(b.BuildpacksDir)
 		if err != nil {
 			return nil, err
 		}
+		if err := bpInfo.verifyAPI(b.BuildpackAPI); err != nil {
+			return nil, err
+		}
 		bpDirName := launch.EscapeID(bp.ID)
 		bpLayersDir := filepath.Join(layersDir, bpDirName)
 		bpPlanDir := filepath.Join(planDir, bpDirName)
@@ -100,20 +168,38 @@ func (b *Builder) Build() (*BuildMetadata, error) {
 			bpPlanPath,
 		)
 		cmd.Dir = appDir
-		cmd.Stdout = b.Out.Writer()
-		cmd.Stderr = b.Err.Writer()
+		buildLog, err := b.openBuildLog(bp)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout = buildLog.Stdout()
+		cmd.Stderr = buildLog.Stderr()
 
+		if err := b.logProvenance(bp, bpInfo.Buildpack.ClearEnv, platformDir, layersDir); err != nil {
+			buildLog.Close()
+			return nil, err
+		}
 		if bpInfo.Buildpack.ClearEnv {
 			cmd.Env = b.Env.List()
 		} else {
 			cmd.Env, err = b.Env.WithPlatform(platformDir)
 			if err != nil {
+				buildLog.Close()
 				return nil, err
 			}
 		}
+		cmd.Env = bpInfo.env(cmd.Env)
 
-		if err := cmd.Run(); err != nil {
-			return nil, err
+		start := time.Now()
+		err = runCmd(b.Context, cmd, b.Timeout)
+		wall := time.Since(start)
+		summary.add(bp, err, wall)
+		usage = append(usage, BuildpackUsage{Buildpack: bp, ResourceUsage: processUsage(cmd.ProcessState, wall)})
+		if closeErr := buildLog.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, timeoutErr(err, bp, "build", b.Timeout)
 		}
 		if err := setupEnv(b.Env, bpLayersDir); err != nil {
 			return nil, err
@@ -123,18 +209,39 @@ func (b *Builder) Build() (*BuildMetadata, error) {
 			return nil, err
 		}
 		var bpBOM []BOMEntry
-		plan, bpBOM = plan.filter(bp, bpPlanOut)
+		plan, bpBOM, err = plan.filter(bp, b.Group.Group[i+1:], bpPlanOut)
+		if err != nil {
+			return nil, err
+		}
 		bom = append(bom, bpBOM...)
 
 		var launch LaunchTOML
 		tomlPath := filepath.Join(bpLayersDir, "launch.toml")
-		if _, err := toml.DecodeFile(tomlPath, &launch); os.IsNotExist(err) {
-			continue
-		} else if err != nil {
+		if _, err := toml.DecodeFile(tomlPath, &launch); err != nil && !os.IsNotExist(err) {
 			return nil, err
 		}
 		procMap.add(launch.Processes)
 		slices = append(slices, launch.Slices...)
+
+		if !b.Resume {
+			continue
+		}
+		checkpoint.Completed = append(checkpoint.Completed, bp)
+		checkpoint.Processes = procMap.list()
+		checkpoint.BOM = bom
+		checkpoint.Slices = slices
+		checkpoint.Plan = plan
+		if err := writeCheckpoint(layersDir, checkpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, entry := range plan.Entries {
+		b.Err.Printf("Warning: plan entry '%s' was not claimed by any buildpack", entry.name())
+	}
+
+	if err := removeCheckpoint(layersDir); err != nil {
+		return nil, err
 	}
 
 	return &BuildMetadata{
@@ -142,9 +249,33 @@ func (b *Builder) Build() (*BuildMetadata, error) {
 		Buildpacks: b.Group.Group,
 		BOM:        bom,
 		Slices:     slices,
+		Usage:      usage,
 	}, nil
 }
 
+func (b *Builder) logProvenance(bp Buildpack, clearEnv bool, platformDir, layersDir string) error {
+	penv, ok := b.Env.(provenanceEnv)
+	if b.Logger == nil || !ok {
+		return nil
+	}
+	if clearEnv {
+		platformDir = ""
+	}
+	var bps []launch.Buildpack
+	for _, groupBP := range b.Group.Group {
+		bps = append(bps, launch.Buildpack{ID: groupBP.ID})
+	}
+	lines, err := penv.DescribeProvenance(platformDir, launch.LayerLabel(layersDir, bps))
+	if err != nil {
+		return err
+	}
+	b.Logger.Debugf("======== Env: %s ========", bp)
+	for _, line := range lines {
+		b.Logger.Debug(line)
+	}
+	return nil
+}
+
 func (p BuildPlan) find(bp Buildpack) buildpackPlan {
 	var out []Require
 	for _, entry := range p.Entries {
@@ -158,19 +289,66 @@ func (p BuildPlan) find(bp Buildpack) buildpackPlan {
 	return buildpackPlan{Entries: out}
 }
 
-// TODO: ensure at least one claimed entry of each name is provided by the BP
-func (p BuildPlan) filter(bp Buildpack, plan buildpackPlan) (BuildPlan, []BOMEntry) {
+// filter removes the entries claimed by bp from the plan. It fails if bp
+// claimed an entry that it was not given, or did not claim an entry that none
+// of the later buildpacks provide. Other entries that are not claimed remain in
+// the plan for the later providers.
+func (p BuildPlan) filter(bp Buildpack, later []Buildpack, plan buildpackPlan) (BuildPlan, []BOMEntry, error) {
+	given := p.find(bp)
+	for _, entry := range plan.Entries {
+		if !given.hasName(entry.Name) {
+			return BuildPlan{}, nil, errors.Errorf("buildpack %s claimed plan entry '%s' that it was not given", bp, entry.Name)
+		}
+	}
 	var out []BuildPlanEntry
 	for _, entry := range p.Entries {
-		if !plan.has(entry) {
-			out = append(out, entry)
+		if plan.has(entry) {
+			continue
 		}
+		if entry.hasProvider(bp) && !entry.hasLaterProvider(later) {
+			return BuildPlan{}, nil, errors.Errorf("buildpack %s did not claim plan entry '%s' and no later buildpack provides it", bp, entry.name())
+		}
+		out = append(out, entry)
 	}
 	var bom []BOMEntry
 	for _, entry := range plan.Entries {
 		bom = append(bom, BOMEntry{Require: entry, Buildpack: bp})
 	}
-	return BuildPlan{Entries: out}, bom
+	return BuildPlan{Entries: out}, bom, nil
+}
+
+func (be BuildPlanEntry) hasProvider(bp Buildpack) bool {
+	for _, provider := range be.Providers {
+		if provider == bp {
+			return true
+		}
+	}
+	return false
+}
+
+func (be BuildPlanEntry) hasLaterProvider(later []Buildpack) bool {
+	for _, bp := range later {
+		if be.hasProvider(bp) {
+			return true
+		}
+	}
+	return false
+}
+
+func (be BuildPlanEntry) name() string {
+	if len(be.Requires) == 0 {
+		return ""
+	}
+	return be.Requires[0].Name
+}
+
+func (p buildpackPlan) hasName(name string) bool {
+	for _, entry := range p.Entries {
+		if entry.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (p buildpackPlan) has(entry BuildPlanEntry) bool {
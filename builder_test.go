@@ -2,6 +2,7 @@ package lifecycle_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,17 +10,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/pkg/errors"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
 	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/launch"
 	"github.com/buildpacks/lifecycle/testmock"
 )
@@ -164,7 +169,7 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 						{ID: "A", Version: "v1"},
 						{ID: "B", Version: "v2"},
 					},
-				}); s != "" {
+				}, cmpopts.IgnoreFields(lifecycle.BuildMetadata{}, "Usage")); s != "" {
 					t.Fatalf("Unexpected metadata:\n%s\n", s)
 				}
 			})
@@ -180,7 +185,7 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 						{ID: "A", Version: "v1"},
 						{ID: "B", Version: "v2"},
 					},
-				}); s != "" {
+				}, cmpopts.IgnoreFields(lifecycle.BuildMetadata{}, "Usage")); s != "" {
 					t.Fatalf("Unexpected:\n%s\n", s)
 				}
 			})
@@ -300,6 +305,9 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 						`name = "dep2"`+"\n"+
 						`version = "v4"`+"\n"+
 						"[[entries]]\n"+
+						`name = "dep2-next"`+"\n"+
+						`version = "v5"`+"\n"+
+						"[[entries]]\n"+
 						`name = "dep2-replace"`+"\n"+
 						`version = "v8"`+"\n",
 					filepath.Join(appDir, "build-plan-out-B-v2.toml"),
@@ -331,12 +339,16 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 							Require:   lifecycle.Require{Name: "dep2", Version: "v4"},
 							Buildpack: lifecycle.Buildpack{ID: "B", Version: "v2"},
 						},
+						{
+							Require:   lifecycle.Require{Name: "dep2-next", Version: "v5"},
+							Buildpack: lifecycle.Buildpack{ID: "B", Version: "v2"},
+						},
 						{
 							Require:   lifecycle.Require{Name: "dep2-replace", Version: "v8"},
 							Buildpack: lifecycle.Buildpack{ID: "B", Version: "v2"},
 						},
 					},
-				}); s != "" {
+				}, cmpopts.IgnoreFields(lifecycle.BuildMetadata{}, "Usage")); s != "" {
 					t.Fatalf("Unexpected:\n%s\n", s)
 				}
 
@@ -361,6 +373,337 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("build output logging is configured", func() {
+			it.Before(func() {
+				env.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil).AnyTimes()
+			})
+
+			it("should pass the output files to bin/build if no option is set", func() {
+				outFile, err := os.Create(filepath.Join(tmpDir, "stdout"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer outFile.Close()
+				builder.Out = log.New(outFile, "", 0)
+				mkfile(t, "", filepath.Join(appDir, "build-stdout-type"))
+
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(rdfile(t, filepath.Join(appDir, "build-stdout-type-A-v1")), "file\n"); s != "" {
+					t.Fatalf("Unexpected stdout type:\n%s\n", s)
+				}
+				if s := cmp.Diff(rdfile(t, filepath.Join(tmpDir, "stdout")), "build out: A@v1\nbuild out: B@v2\n"); s != "" {
+					t.Fatalf("Unexpected stdout:\n%s\n", s)
+				}
+			})
+
+			it("should prefix each line with the buildpack", func() {
+				builder.LogPrefix = true
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(stdout.String(), "[A@v1] build out: A@v1\n[B@v2] build out: B@v2\n"); s != "" {
+					t.Fatalf("Unexpected stdout:\n%s\n", s)
+				}
+				if s := cmp.Diff(stderr.String(), "[A@v1] build err: A@v1\n[B@v2] build err: B@v2\n"); s != "" {
+					t.Fatalf("Unexpected stderr:\n%s\n", s)
+				}
+			})
+
+			it("should prefix progress lines ending in a carriage return", func() {
+				builder.LogPrefix = true
+				mkfile(t, "10%\r20%\r", filepath.Join(appDir, "build-out-A-v1"))
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(stdout.String(), "[A@v1] build out: A@v1\n[A@v1] 10%\r[A@v1] 20%\r[B@v2] build out: B@v2\n"); s != "" {
+					t.Fatalf("Unexpected stdout:\n%s\n", s)
+				}
+			})
+
+			it("should split lines that exceed the maximum length", func() {
+				builder.LogPrefix = true
+				mkfile(t, strings.Repeat("x", 200*1024), filepath.Join(appDir, "build-out-A-v1"))
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+				if len(lines) < 5 {
+					t.Fatalf("Expected the long line to be split, got %d lines\n", len(lines))
+				}
+				var xs int
+				for _, line := range lines[1 : len(lines)-1] {
+					if !strings.HasPrefix(line, "[A@v1] ") || len(line) > 2*64*1024 {
+						t.Fatalf("Unexpected line of length %d:\n%.40s\n", len(line), line)
+					}
+					xs += len(line) - len("[A@v1] ")
+				}
+				if xs != 200*1024 {
+					t.Fatalf("Unexpected output length: %d\n", xs)
+				}
+			})
+
+			it("should prefix each line with a timestamp", func() {
+				builder.LogPrefix = true
+				builder.LogTimestamps = true
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				re := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ \[A@v1\] build out: A@v1\n` +
+					`\d{4}-\d\d-\d\dT\d\d:\d\d:\d\dZ \[B@v2\] build out: B@v2\n$`)
+				if !re.MatchString(stdout.String()) {
+					t.Fatalf("Unexpected stdout:\n%s\n", stdout)
+				}
+			})
+
+			it("should write each buildpack's output to a file in the log directory", func() {
+				builder.LogDir = filepath.Join(tmpDir, "logs")
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				for _, bp := range []string{"A@v1", "B@v2"} {
+					contents := rdfile(t, filepath.Join(builder.LogDir, bp[:1]+".log"))
+					if !strings.Contains(contents, "build out: "+bp+"\n") || !strings.Contains(contents, "build err: "+bp+"\n") {
+						t.Fatalf("Unexpected log for %s:\n%s\n", bp, contents)
+					}
+				}
+				if stdout.String() != "build out: A@v1\nbuild out: B@v2\n" {
+					t.Fatalf("Unexpected stdout:\n%s\n", stdout)
+				}
+			})
+
+			it("should print a summary of each buildpack", func() {
+				builder.LogSummary = true
+				mkfile(t, "3", filepath.Join(appDir, "build-status-B-v2"))
+				if _, err := builder.Build(); err == nil {
+					t.Fatal("Expected error")
+				}
+				re := regexp.MustCompile(`======== Build summary ========\n` +
+					`A@v1  exit 0     \S+\n` +
+					`B@v2  exit 3     \S+\n$`)
+				if !re.MatchString(stdout.String()) {
+					t.Fatalf("Unexpected stdout:\n%s\n", stdout)
+				}
+			})
+
+			it("should record and print the resources used by each buildpack", func() {
+				builder.LogUsage = true
+				metadata, err := builder.Build()
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if len(metadata.Usage) != 2 {
+					t.Fatalf("Unexpected usage:\n%+v\n", metadata.Usage)
+				}
+				for i, bp := range []lifecycle.Buildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v2"}} {
+					if u := metadata.Usage[i]; u.Buildpack != bp || u.WallTime <= 0 || u.MaxRSS <= 0 {
+						t.Fatalf("Unexpected usage for %s:\n%+v\n", bp, u)
+					}
+				}
+				re := regexp.MustCompile(`======== Build resource usage ========\n` +
+					`(A@v1|B@v2)  wall \S+s  user \S+s  sys \S+s  max-rss \S+ MiB\n` +
+					`(A@v1|B@v2)  wall \S+s  user \S+s  sys \S+s  max-rss \S+ MiB\n$`)
+				if !re.MatchString(stdout.String()) {
+					t.Fatalf("Unexpected stdout:\n%s\n", stdout)
+				}
+			})
+		})
+
+		when("a failed build is resumed", func() {
+			it.Before(func() {
+				env.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil).AnyTimes()
+				mkdir(t, filepath.Join(appDir, "layers-A-v1", "layer1"))
+				mkfile(t, "build = true", filepath.Join(appDir, "layers-A-v1", "layer1.toml"))
+				mkfile(t, "[[processes]]\ntype = \"A-type\"\ncommand = \"A-cmd\"\n", filepath.Join(appDir, "launch-A-v1.toml"))
+				env.EXPECT().AddRootDir(filepath.Join(layersDir, "A", "layer1")).AnyTimes()
+				env.EXPECT().AddEnvDir(gomock.Any()).AnyTimes()
+
+				mkfile(t, "1", filepath.Join(appDir, "build-status-B-v2"))
+				builder.Resume = true
+				if _, err := builder.Build(); err == nil {
+					t.Fatal("Expected error")
+				}
+				if err := os.Remove(filepath.Join(appDir, "build-status-B-v2")); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			it("should skip the buildpacks that completed", func() {
+				metadata, err := builder.Build()
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := rdfile(t, filepath.Join(appDir, "build-info-A-v1")); s != "TEST_ENV: Av1\n" {
+					t.Fatalf("Unexpected info:\n%s\n", s)
+				}
+				if s := rdfile(t, filepath.Join(appDir, "build-info-B-v2")); s != "TEST_ENV: Av1\nTEST_ENV: Av1\n" {
+					t.Fatalf("Unexpected info:\n%s\n", s)
+				}
+				if s := cmp.Diff(metadata.Processes, []launch.Process{{Type: "A-type", Command: "A-cmd"}}); s != "" {
+					t.Fatalf("Unexpected processes:\n%s\n", s)
+				}
+				if !strings.Contains(stdout.String(), "Resuming build after 1 completed buildpack(s)\n") {
+					t.Fatalf("Unexpected stdout:\n%s\n", stdout)
+				}
+				if _, err := os.Stat(filepath.Join(layersDir, "build-checkpoint.toml")); !os.IsNotExist(err) {
+					t.Fatalf("Expected checkpoint to be removed:\n%v\n", err)
+				}
+			})
+
+			it("should remove the layers left by the buildpack that failed", func() {
+				mkdir(t, filepath.Join(layersDir, "B", "partial"))
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if _, err := os.Stat(filepath.Join(layersDir, "B", "partial")); !os.IsNotExist(err) {
+					t.Fatalf("Expected partial layer to be removed:\n%v\n", err)
+				}
+				if _, err := os.Stat(filepath.Join(layersDir, "A", "layer1")); err != nil {
+					t.Fatalf("Expected completed layer to remain:\n%v\n", err)
+				}
+			})
+
+			it("should rebuild every buildpack if the plan changed", func() {
+				builder.Plan = lifecycle.BuildPlan{Entries: []lifecycle.BuildPlanEntry{{
+					Providers: []lifecycle.Buildpack{{ID: "B", Version: "v2"}},
+					Requires:  []lifecycle.Require{{Name: "dep1"}},
+				}}}
+				mkfile(t, "[[entries]]\nname = \"dep1\"\n", filepath.Join(appDir, "build-plan-out-B-v2.toml"))
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := rdfile(t, filepath.Join(appDir, "build-info-A-v1")); s != "TEST_ENV: Av1\nTEST_ENV: Av1\n" {
+					t.Fatalf("Unexpected info:\n%s\n", s)
+				}
+				if !strings.Contains(stderr.String(), "Warning: not resuming build: group or plan changed since the last checkpoint\n") {
+					t.Fatalf("Unexpected stderr:\n%s\n", stderr)
+				}
+			})
+		})
+
+		when("the first buildpack of a resumed build failed", func() {
+			it("should remove its layers", func() {
+				env.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil).AnyTimes()
+				mkdir(t, filepath.Join(appDir, "layers-A-v1", "partial"))
+				mkfile(t, "1", filepath.Join(appDir, "build-status-A-v1"))
+				builder.Resume = true
+				if _, err := builder.Build(); err == nil {
+					t.Fatal("Expected error")
+				}
+				if err := os.RemoveAll(filepath.Join(appDir, "layers-A-v1")); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Remove(filepath.Join(appDir, "build-status-A-v1")); err != nil {
+					t.Fatal(err)
+				}
+
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if _, err := os.Stat(filepath.Join(layersDir, "A", "partial")); !os.IsNotExist(err) {
+					t.Fatalf("Expected partial layer to be removed:\n%v\n", err)
+				}
+			})
+		})
+
+		when("resuming is not enabled", func() {
+			it("should not leave a checkpoint after a failed build", func() {
+				env.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil).AnyTimes()
+				mkfile(t, "1", filepath.Join(appDir, "build-status-B-v2"))
+				if _, err := builder.Build(); err == nil {
+					t.Fatal("Expected error")
+				}
+				if _, err := os.Stat(filepath.Join(layersDir, "build-checkpoint.toml")); !os.IsNotExist(err) {
+					t.Fatalf("Expected no checkpoint:\n%v\n", err)
+				}
+			})
+		})
+
+		when("the build plan is not consumed", func() {
+			it.Before(func() {
+				env.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil).AnyTimes()
+				builder.Plan = lifecycle.BuildPlan{
+					Entries: []lifecycle.BuildPlanEntry{
+						{
+							Providers: []lifecycle.Buildpack{{ID: "A", Version: "v1"}},
+							Requires:  []lifecycle.Require{{Name: "dep1"}},
+						},
+						{
+							Providers: []lifecycle.Buildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v2"}},
+							Requires:  []lifecycle.Require{{Name: "dep2"}},
+						},
+					},
+				}
+			})
+
+			it("should fail if a buildpack claims an entry it was not given", func() {
+				mkfile(t, "[[entries]]\nname = \"dep1\"\n[[entries]]\nname = \"dep3\"\n",
+					filepath.Join(appDir, "build-plan-out-A-v1.toml"),
+				)
+				_, err := builder.Build()
+				if err == nil || err.Error() != "buildpack A@v1 claimed plan entry 'dep3' that it was not given" {
+					t.Fatalf("Incorrect error: %v\n", err)
+				}
+			})
+
+			it("should fail once the last provider of an entry does not claim it", func() {
+				mkfile(t, "[[entries]]\nname = \"dep2\"\n",
+					filepath.Join(appDir, "build-plan-out-A-v1.toml"),
+				)
+				_, err := builder.Build()
+				if err == nil || err.Error() != "buildpack A@v1 did not claim plan entry 'dep1' and no later buildpack provides it" {
+					t.Fatalf("Incorrect error: %v\n", err)
+				}
+				if _, err := os.Stat(filepath.Join(appDir, "build-plan-in-B-v2.toml")); !os.IsNotExist(err) {
+					t.Fatalf("Expected later buildpacks not to run: %v\n", err)
+				}
+				if s := stderr.String(); strings.Contains(s, "Warning") {
+					t.Fatalf("Unexpected stderr:\n%s\n", s)
+				}
+			})
+
+			it("should fail with the last provider of an entry that no provider claims", func() {
+				mkfile(t, "", filepath.Join(appDir, "build-plan-out-A-v1.toml"))
+				mkfile(t, "[[entries]]\nname = \"dep1\"\n", filepath.Join(appDir, "build-plan-out-B-v2.toml"))
+				builder.Plan.Entries[0].Providers = append(builder.Plan.Entries[0].Providers, lifecycle.Buildpack{ID: "B", Version: "v2"})
+
+				_, err := builder.Build()
+				if err == nil || err.Error() != "buildpack B@v2 did not claim plan entry 'dep2' and no later buildpack provides it" {
+					t.Fatalf("Incorrect error: %v\n", err)
+				}
+			})
+
+			it("should pass entries that are not claimed to later providers", func() {
+				mkfile(t, "[[entries]]\nname = \"dep1\"\n",
+					filepath.Join(appDir, "build-plan-out-A-v1.toml"),
+				)
+				metadata, err := builder.Build()
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(metadata.BOM, []lifecycle.BOMEntry{
+					{Require: lifecycle.Require{Name: "dep1"}, Buildpack: lifecycle.Buildpack{ID: "A", Version: "v1"}},
+					{Require: lifecycle.Require{Name: "dep2"}, Buildpack: lifecycle.Buildpack{ID: "B", Version: "v2"}},
+				}); s != "" {
+					t.Fatalf("Unexpected BOM:\n%s\n", s)
+				}
+			})
+
+			it("should report entries that no buildpack in the group provides", func() {
+				builder.Plan.Entries = append(builder.Plan.Entries, lifecycle.BuildPlanEntry{
+					Providers: []lifecycle.Buildpack{{ID: "C", Version: "v1"}},
+					Requires:  []lifecycle.Require{{Name: "dep3"}},
+				})
+				if _, err := builder.Build(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := stderr.String(); !strings.HasSuffix(s, "Warning: plan entry 'dep3' was not claimed by any buildpack\n") {
+					t.Fatalf("Unexpected stderr:\n%s\n", s)
+				}
+			})
+		})
+
 		when("building succeeds with a clear env", func() {
 			it("should not apply user-provided env vars", func() {
 				env.EXPECT().List().Return(append(os.Environ(), "TEST_ENV=Av1.clear"))
@@ -426,6 +769,46 @@ func testBuilder(t *testing.T, when spec.G, it spec.S) {
 				}
 			})
 
+			it("should error when a buildpack declares an incompatible Buildpack API", func() {
+				builder.Group = lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{{ID: "K", Version: "v1"}},
+				}
+				builder.BuildpackAPI = api.MustParse("0.2")
+
+				_, err := builder.Build()
+				if _, ok := err.(*lifecycle.ErrorIncompatibleAPI); !ok {
+					t.Fatalf("Incorrect error: %s\n", err)
+				}
+			})
+
+			it("should error when a buildpack times out", func() {
+				env.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
+				mkfile(t, "10", filepath.Join(appDir, "build-sleep-A-v1"))
+				builder.Timeout = time.Second
+
+				start := time.Now()
+				_, err := builder.Build()
+				if err == nil {
+					t.Fatal("Expected error.\n")
+				} else if err.Error() != "buildpack A@v1 timed out after 1s during build" {
+					t.Fatalf("Incorrect error: %s\n", err)
+				}
+				if d := time.Since(start); d > 5*time.Second {
+					t.Fatalf("Build was not interrupted: took %s", d)
+				}
+			})
+
+			it("should error when the context is cancelled", func() {
+				env.EXPECT().WithPlatform(platformDir).Return(append(os.Environ(), "TEST_ENV=Av1"), nil)
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				builder.Context = ctx
+
+				if _, err := builder.Build(); err != context.Canceled {
+					t.Fatalf("Incorrect error: %s\n", err)
+				}
+			})
+
 			when("modifying the env fails", func() {
 				var appendErr error
 
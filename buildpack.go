@@ -1,13 +1,37 @@
 package lifecycle
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
 
+	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/launch"
+	"github.com/buildpacks/lifecycle/semver"
 )
 
+const EnvBuildpackAPI = "CNB_BUILDPACK_API"
+
+// ErrorIncompatibleAPI is returned when a buildpack declares a Buildpack API
+// that the lifecycle does not support.
+type ErrorIncompatibleAPI struct {
+	Buildpack    Buildpack
+	API          string
+	LifecycleAPI string
+}
+
+func (e *ErrorIncompatibleAPI) Error() string {
+	return fmt.Sprintf(
+		"buildpack %s declares Buildpack API version %s which is incompatible with the lifecycle's Buildpack API version %s",
+		e.Buildpack, e.API, e.LifecycleAPI,
+	)
+}
+
 type Buildpack struct {
 	ID       string `toml:"id" json:"id"`
 	Version  string `toml:"version" json:"version"`
@@ -23,7 +47,52 @@ func (bp Buildpack) noOpt() Buildpack {
 	return bp
 }
 
+// resolve returns the buildpack with its version replaced by the highest
+// version present in buildpacksDir that satisfies it, when the version is
+// omitted or is a semver range rather than an existing version directory.
+func (bp Buildpack) resolve(buildpacksDir string) (Buildpack, error) {
+	idDir := filepath.Join(buildpacksDir, launch.EscapeID(bp.ID))
+	if bp.Version != "" {
+		if _, err := os.Stat(filepath.Join(idDir, bp.Version)); err == nil {
+			return bp, nil
+		}
+	}
+	constraint, err := semver.ParseConstraint(bp.Version)
+	if err != nil {
+		return bp, nil
+	}
+	files, err := ioutil.ReadDir(idDir)
+	if err != nil {
+		return Buildpack{}, errors.Wrapf(err, "find versions of buildpack %s", bp.ID)
+	}
+	var (
+		best    string
+		bestVer semver.Version
+	)
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		v, err := semver.Parse(f.Name())
+		if err != nil || !constraint.Check(v) {
+			continue
+		}
+		if best == "" || v.Compare(bestVer) > 0 {
+			best, bestVer = f.Name(), v
+		}
+	}
+	if best == "" {
+		return Buildpack{}, errors.Errorf("no version of buildpack %s matches '%s'", bp.ID, bp.Version)
+	}
+	bp.Version = best
+	return bp, nil
+}
+
 func (bp Buildpack) lookup(buildpacksDir string) (*buildpackTOML, error) {
+	bp, err := bp.resolve(buildpacksDir)
+	if err != nil {
+		return nil, err
+	}
 	bpTOML := buildpackTOML{}
 	bpPath, err := filepath.Abs(filepath.Join(buildpacksDir, launch.EscapeID(bp.ID), bp.Version))
 	if err != nil {
@@ -38,9 +107,11 @@ func (bp Buildpack) lookup(buildpacksDir string) (*buildpackTOML, error) {
 }
 
 type buildpackTOML struct {
-	Buildpack buildpackInfo  `toml:"buildpack"`
-	Order     BuildpackOrder `toml:"order"`
-	Path      string         `toml:"-"`
+	API       string           `toml:"api"`
+	Buildpack buildpackInfo    `toml:"buildpack"`
+	Order     BuildpackOrder   `toml:"order"`
+	Stacks    []buildpackStack `toml:"stacks"`
+	Path      string           `toml:"-"`
 }
 
 type buildpackInfo struct {
@@ -50,6 +121,78 @@ type buildpackInfo struct {
 	ClearEnv bool   `toml:"clear-env,omitempty"`
 }
 
+type buildpackStack struct {
+	ID     string   `toml:"id"`
+	Mixins []string `toml:"mixins"`
+}
+
 func (bp buildpackTOML) String() string {
 	return bp.Buildpack.Name + " " + bp.Buildpack.Version
 }
+
+// verifyAPI returns an error if the buildpack declares a Buildpack API that is
+// incompatible with lifecycleAPI. Buildpacks that do not declare an API are not checked.
+func (bp *buildpackTOML) verifyAPI(lifecycleAPI *api.Version) error {
+	if lifecycleAPI == nil || bp.API == "" {
+		return nil
+	}
+	bpAPI, err := api.NewVersion(bp.API)
+	if err != nil {
+		return errors.Wrapf(err, "parse Buildpack API of buildpack %s", bp.info())
+	}
+	if !api.IsAPICompatible(lifecycleAPI, bpAPI) {
+		return &ErrorIncompatibleAPI{
+			Buildpack:    bp.info(),
+			API:          bpAPI.String(),
+			LifecycleAPI: lifecycleAPI.String(),
+		}
+	}
+	return nil
+}
+
+func (bp *buildpackTOML) info() Buildpack {
+	return Buildpack{ID: bp.Buildpack.ID, Version: bp.Buildpack.Version}
+}
+
+func (bp *buildpackTOML) env(env []string) []string {
+	if bp.API == "" {
+		return env
+	}
+	return append(append([]string{}, env...), EnvBuildpackAPI+"="+bp.API)
+}
+
+// verifyStack returns an error describing why the buildpack cannot run on the
+// given stack. Buildpacks that do not declare any stacks are not checked.
+func (bp *buildpackTOML) verifyStack(stackID string, mixins []string) error {
+	if stackID == "" || len(bp.Stacks) == 0 {
+		return nil
+	}
+	for _, stack := range bp.Stacks {
+		if stack.ID != stackID {
+			continue
+		}
+		var missing []string
+		for _, mixin := range stack.Mixins {
+			if !hasMixin(mixins, mixin) {
+				missing = append(missing, mixin)
+			}
+		}
+		if len(missing) > 0 {
+			return errors.Errorf("buildpack %s requires missing mixins for stack '%s': %s", bp.info(), stackID, strings.Join(missing, ", "))
+		}
+		return nil
+	}
+	return errors.Errorf("buildpack %s does not support stack '%s'", bp.info(), stackID)
+}
+
+// hasMixin reports whether mixin is present, where a mixin scoped to a stage
+// (e.g. "build:git") is also satisfied by the unscoped mixin.
+func hasMixin(mixins []string, mixin string) bool {
+	unscoped := strings.TrimPrefix(strings.TrimPrefix(mixin, "build:"), "run:")
+	for _, m := range mixins {
+		if m == mixin || m == unscoped {
+			return true
+		}
+	}
+	return false
+}
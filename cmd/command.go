@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 type Command interface {
@@ -49,3 +53,25 @@ func Run(c Command, asSubcommand bool) {
 	}
 	Exit(c.Exec())
 }
+
+var (
+	signalCtx     context.Context
+	signalCtxOnce sync.Once
+)
+
+// SignalContext returns a context that is cancelled when the process first
+// receives an interrupt or termination signal.
+func SignalContext() context.Context {
+	signalCtxOnce.Do(func() {
+		var cancel context.CancelFunc
+		signalCtx, cancel = context.WithCancel(context.Background())
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			signal.Stop(sigs)
+			cancel()
+		}()
+	})
+	return signalCtx
+}
@@ -16,8 +16,11 @@ const (
 	CodeFailedBuild  = 7
 	CodeFailedLaunch = 8
 	// 9: CodeFailedUpdate
-	CodeFailedSave   = 10
-	CodeIncompatible = 11
+	CodeFailedSave            = 10
+	CodeIncompatible          = 11
+	CodeCyclicOrder           = 12
+	CodeIncompatibleBuildpack = 13
+	CodeFailedValidation      = 14
 )
 
 type ErrorFail struct {
@@ -34,6 +37,14 @@ func (e *ErrorFail) Error() string {
 	return fmt.Sprintf("%s: %s", message, e.Err)
 }
 
+// ErrorStatus is the exit status of a process that has already reported its
+// own failure, so Exit does not log it.
+type ErrorStatus int
+
+func (e ErrorStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
 func FailCode(code int, action ...string) *ErrorFail {
 	return FailErrCode(nil, code, action...)
 }
@@ -54,6 +65,9 @@ func Exit(err error) {
 	if err == nil {
 		os.Exit(0)
 	}
+	if status, ok := err.(ErrorStatus); ok {
+		os.Exit(int(status))
+	}
 	Logger.Errorf("%s\n", err)
 	if err, ok := err.(*ErrorFail); ok {
 		os.Exit(err.Code)
@@ -4,7 +4,10 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -30,6 +33,7 @@ const (
 	EnvOrderPath           = "CNB_ORDER_PATH"
 	EnvGroupPath           = "CNB_GROUP_PATH"
 	EnvStackPath           = "CNB_STACK_PATH"
+	EnvStackID             = "CNB_STACK_ID"
 	EnvPlanPath            = "CNB_PLAN_PATH"
 	EnvUseDaemon           = "CNB_USE_DAEMON" // defaults to false
 	EnvRunImage            = "CNB_RUN_IMAGE"
@@ -42,9 +46,26 @@ const (
 	EnvRegistryAuth        = "CNB_REGISTRY_AUTH"
 	EnvSkipLayers          = "CNB_ANALYZE_SKIP_LAYERS" // defaults to false
 	EnvSkipRestore         = "CNB_SKIP_RESTORE"        // defaults to false
-	EnvProcessType         = "CNB_PROCESS_TYPE"
+	EnvProcessType         = "CNB_PROCESS_TYPE"        // the launcher accepts a comma-separated list
 	EnvLogLevel            = "CNB_LOG_LEVEL"
 	EnvProjectMetadataPath = "CNB_PROJECT_METADATA_PATH"
+	EnvDetectReportPath    = "CNB_DETECT_REPORT_PATH"
+	EnvDetectTimeout       = "CNB_DETECT_TIMEOUT"     // defaults to no timeout
+	EnvDetectConcurrency   = "CNB_DETECT_CONCURRENCY" // defaults to the number of CPUs
+	EnvBuildTimeout        = "CNB_BUILD_TIMEOUT"      // defaults to no timeout
+	EnvPlanGraphPath       = "CNB_PLAN_GRAPH_PATH"
+	EnvForceDetect         = "CNB_FORCE_DETECT"         // defaults to false
+	EnvPreBuildpacks       = "CNB_PRE_BUILDPACKS"       // comma-separated
+	EnvPostBuildpacks      = "CNB_POST_BUILDPACKS"      // comma-separated
+	EnvBuildLogPrefix      = "CNB_BUILD_LOG_PREFIX"     // defaults to false
+	EnvBuildLogTimestamps  = "CNB_BUILD_LOG_TIMESTAMPS" // defaults to false
+	EnvBuildLogDir         = "CNB_BUILD_LOG_DIR"
+	EnvBuildLogSummary     = "CNB_BUILD_LOG_SUMMARY" // defaults to false
+	EnvLogUsage            = "CNB_LOG_USAGE"         // defaults to false
+	EnvBuildResume         = "CNB_BUILD_RESUME"      // defaults to false
+	EnvLaunchDebug         = "CNB_LAUNCH_DEBUG"      // defaults to false
+	EnvExpandEnv           = "CNB_EXPAND_ENV"        // defaults to false
+	EnvLaunchInit          = "CNB_LAUNCH_INIT"       // defaults to false
 )
 
 var flagSet = flag.NewFlagSet("lifecycle", flag.ExitOnError)
@@ -61,6 +82,30 @@ func FlagBuildpacksDir(dir *string) {
 	flagSet.StringVar(dir, "buildpacks", envOrDefault(EnvBuildpacksDir, DefaultBuildpacksDir), "path to buildpacks directory")
 }
 
+func FlagBuildLogDir(dir *string) {
+	flagSet.StringVar(dir, "log-dir", os.Getenv(EnvBuildLogDir), "path to a directory to write each buildpack's build output to")
+}
+
+func FlagBuildLogPrefix(prefix *bool) {
+	flagSet.BoolVar(prefix, "log-prefix", boolEnv(EnvBuildLogPrefix), "prefix each line of build output with the buildpack")
+}
+
+func FlagBuildLogSummary(summary *bool) {
+	flagSet.BoolVar(summary, "log-summary", boolEnv(EnvBuildLogSummary), "print the exit status and duration of each buildpack after building")
+}
+
+func FlagBuildLogTimestamps(timestamps *bool) {
+	flagSet.BoolVar(timestamps, "log-timestamps", boolEnv(EnvBuildLogTimestamps), "prefix each line of build output with a timestamp")
+}
+
+func FlagBuildResume(resume *bool) {
+	flagSet.BoolVar(resume, "resume", boolEnv(EnvBuildResume), "checkpoint after each buildpack and skip buildpacks completed by a previous failed build of the same group and plan")
+}
+
+func FlagBuildTimeout(timeout *time.Duration) {
+	flagSet.DurationVar(timeout, "build-timeout", durationEnv(EnvBuildTimeout), "maximum duration of each buildpack's build")
+}
+
 func FlagCacheDir(dir *string) {
 	flagSet.StringVar(dir, "cache-dir", os.Getenv(EnvCacheDir), "path to cache directory")
 }
@@ -69,6 +114,26 @@ func FlagCacheImage(image *string) {
 	flagSet.StringVar(image, "cache-image", os.Getenv(EnvCacheImage), "cache image tag name")
 }
 
+func FlagDetectConcurrency(n *int) {
+	flagSet.IntVar(n, "detect-concurrency", intEnvOrDefault(EnvDetectConcurrency, runtime.NumCPU()), "maximum number of buildpacks to detect concurrently")
+}
+
+func FlagDetectReportPath(path *string) {
+	flagSet.StringVar(path, "report", os.Getenv(EnvDetectReportPath), "path to write a detect report (.json or .toml)")
+}
+
+func FlagDetectTimeout(timeout *time.Duration) {
+	flagSet.DurationVar(timeout, "detect-timeout", durationEnv(EnvDetectTimeout), "maximum duration of each buildpack's detection")
+}
+
+func FlagForceDetect(force *bool) {
+	flagSet.BoolVar(force, "force-detect", boolEnv(EnvForceDetect), "run detection even if cached detection results match")
+}
+
+func FlagExpandEnv(expand *bool) {
+	flagSet.BoolVar(expand, "expand-env", boolEnv(EnvExpandEnv), "expand $VAR and ${VAR} references in layer env files")
+}
+
 func FlagGID(gid *int) {
 	flagSet.IntVar(gid, "gid", intEnv(EnvGID), "GID of user's group in the stack's build and run images")
 }
@@ -85,6 +150,10 @@ func FlagLauncherPath(path *string) {
 	flagSet.StringVar(path, "launcher", DefaultLauncherPath, "path to launcher binary")
 }
 
+func FlagLogUsage(usage *bool) {
+	flagSet.BoolVar(usage, "log-usage", boolEnv(EnvLogUsage), "print the resources used by each buildpack, ranked by wall time")
+}
+
 func FlagLayersDir(dir *string) {
 	flagSet.StringVar(dir, "layers", envOrDefault(EnvLayersDir, DefaultLayersDir), "path to layers directory")
 }
@@ -93,6 +162,10 @@ func FlagOrderPath(path *string) {
 	flagSet.StringVar(path, "order", envOrDefault(EnvOrderPath, DefaultOrderPath), "path to order.toml")
 }
 
+func FlagPlanGraphPath(path *string) {
+	flagSet.StringVar(path, "plan-graph", os.Getenv(EnvPlanGraphPath), "path to write the resolved build plan graph (.dot or .json)")
+}
+
 func FlagPlanPath(path *string) {
 	flagSet.StringVar(path, "plan", envOrDefault(EnvPlanPath, DefaultPlanPath), "path to plan.toml")
 }
@@ -109,6 +182,16 @@ func FlagRunImage(image *string) {
 	flagSet.StringVar(image, "run-image", os.Getenv(EnvRunImage), "reference to run image")
 }
 
+func FlagPreBuildpacks(bps *StringSlice) {
+	*bps = sliceEnv(EnvPreBuildpacks)
+	flagSet.Var(&envSlice{values: bps}, "pre-buildpack", "buildpack <id>[@<version>][?] to run before every group, optional if ? is given (may be repeated)")
+}
+
+func FlagPostBuildpacks(bps *StringSlice) {
+	*bps = sliceEnv(EnvPostBuildpacks)
+	flagSet.Var(&envSlice{values: bps}, "post-buildpack", "buildpack <id>[@<version>][?] to run after every group, optional if ? is given (may be repeated)")
+}
+
 func FlagPreviousImage(image *string) {
 	flagSet.StringVar(image, "previous-image", os.Getenv(EnvPreviousImage), "reference to previous image")
 }
@@ -164,6 +247,28 @@ func (s *StringSlice) Set(value string) error {
 	return nil
 }
 
+// envSlice is a repeatable flag with a default value read from the env. The
+// flag replaces the default instead of appending to it.
+type envSlice struct {
+	values *StringSlice
+	set    bool
+}
+
+func (s *envSlice) String() string {
+	if s.values == nil {
+		return "[]"
+	}
+	return s.values.String()
+}
+
+func (s *envSlice) Set(value string) error {
+	if !s.set {
+		*s.values = nil
+		s.set = true
+	}
+	return s.values.Set(value)
+}
+
 func intEnv(k string) int {
 	v := os.Getenv(k)
 	d, err := strconv.Atoi(v)
@@ -173,6 +278,13 @@ func intEnv(k string) int {
 	return d
 }
 
+func intEnvOrDefault(k string, defaultVal int) int {
+	if d := intEnv(k); d > 0 {
+		return d
+	}
+	return defaultVal
+}
+
 func boolEnv(k string) bool {
 	v := os.Getenv(k)
 	b, err := strconv.ParseBool(v)
@@ -182,6 +294,23 @@ func boolEnv(k string) bool {
 	return b
 }
 
+func sliceEnv(k string) StringSlice {
+	v := os.Getenv(k)
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+func durationEnv(k string) time.Duration {
+	v := os.Getenv(k)
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
 func envOrDefault(key string, defaultVal string) string {
 	if envVal := os.Getenv(key); envVal != "" {
 		return envVal
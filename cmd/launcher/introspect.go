@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/buildpacks/lifecycle/cmd"
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+const (
+	argListProcesses = "--cnb-list-processes"
+	argEnv           = "--cnb-env"
+	argJSON          = "--json"
+)
+
+// introspect runs an introspection command, which prints information about
+// the image without launching a process:
+//
+//	launcher --cnb-list-processes [--json]
+//	launcher --cnb-env [<type>] [--json]
+//
+// It returns false if args is not an introspection command.
+func introspect(launcher *launch.Launcher, args []string, w io.Writer) (bool, error) {
+	if len(args) == 0 || (args[0] != argListProcesses && args[0] != argEnv) {
+		return false, nil
+	}
+	var (
+		asJSON     bool
+		positional []string
+	)
+	for _, arg := range args[1:] {
+		if arg == argJSON {
+			asJSON = true
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+
+	switch args[0] {
+	case argListProcesses:
+		if len(positional) > 0 {
+			return true, cmd.FailErrCode(fmt.Errorf("unexpected arguments: %s", strings.Join(positional, " ")), cmd.CodeInvalidArgs, "parse arguments")
+		}
+		return true, listProcesses(launcher, w, asJSON)
+	default:
+		if len(positional) > 1 {
+			return true, cmd.FailErrCode(fmt.Errorf("unexpected arguments: %s", strings.Join(positional[1:], " ")), cmd.CodeInvalidArgs, "parse arguments")
+		}
+		processType := launcher.DefaultProcessType
+		if len(positional) == 1 {
+			processType = positional[0]
+		}
+		return true, printEnv(launcher, processType, w, asJSON)
+	}
+}
+
+func listProcesses(launcher *launch.Launcher, w io.Writer, asJSON bool) error {
+	if asJSON {
+		var items []string
+		for _, p := range launcher.Processes {
+			var args []string
+			for _, arg := range p.Args {
+				args = append(args, jsonString(arg))
+			}
+			items = append(items, fmt.Sprintf("{\"type\": %s, \"command\": %s, \"args\": [%s], \"direct\": %t}",
+				jsonString(p.Type), jsonString(p.Command), strings.Join(args, ", "), p.Direct,
+			))
+		}
+		return writeJSON(w, "[", items, "]")
+	}
+	for _, p := range launcher.Processes {
+		line := fmt.Sprintf("%s: %s", p.Type, strings.Join(append([]string{p.Command}, p.Args...), " "))
+		if p.Direct {
+			line += " (direct)"
+		}
+		if p.Type == launcher.DefaultProcessType {
+			line += " (default)"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printEnv(launcher *launch.Launcher, processType string, w io.Writer, asJSON bool) error {
+	vars, err := launcher.ProcessEnv(processType)
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeFailedLaunch, "resolve env")
+	}
+	if asJSON {
+		var items []string
+		for _, kv := range vars {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) == 2 {
+				items = append(items, jsonString(parts[0])+": "+jsonString(parts[1]))
+			}
+		}
+		sort.Strings(items)
+		return writeJSON(w, "{", items, "}")
+	}
+	for _, kv := range vars {
+		if _, err := fmt.Fprintln(w, kv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON writes the items of a JSON array or object, one per line. It is
+// used instead of encoding/json, which adds about 750 KB to the stripped
+// launcher binary.
+func writeJSON(w io.Writer, open string, items []string, close string) error {
+	if len(items) == 0 {
+		_, err := fmt.Fprintln(w, open+close)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s\n  %s\n%s\n", open, strings.Join(items, ",\n  "), close)
+	return err
+}
+
+func jsonString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/env"
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+func TestIntrospect(t *testing.T) {
+	spec.Run(t, "Introspect", testIntrospect, spec.Report(report.Terminal{}))
+}
+
+func testIntrospect(t *testing.T, when spec.G, it spec.S) {
+	var (
+		launcher *launch.Launcher
+		out      bytes.Buffer
+		tmpDir   string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lifecycle.launcher.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		launcher = &launch.Launcher{
+			DefaultProcessType: "web",
+			LayersDir:          tmpDir,
+			AppDir:             tmpDir,
+			Processes: []launch.Process{
+				{Type: "web", Command: "run", Args: []string{`say "hi"`, "a\\b"}, Direct: true},
+				{Type: "worker", Command: "work\tnow"},
+			},
+			Env: env.NewLaunchEnv([]string{"B=line\nbreak", "A=\x01café 日本"}),
+		}
+		out.Reset()
+	})
+
+	it.After(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	when("#jsonString", func() {
+		it("should escape strings like encoding/json", func() {
+			for _, s := range []string{
+				"",
+				"plain",
+				`"quoted"`,
+				`back\slash`,
+				"new\nline\ttab\rreturn",
+				"\x00\x01\x1f\x7f",
+				"café 日本 \U0001f600",
+			} {
+				var got string
+				if err := json.Unmarshal([]byte(jsonString(s)), &got); err != nil {
+					t.Fatalf("invalid JSON for %q: %s: %s", s, jsonString(s), err)
+				}
+				if got != s {
+					t.Fatalf("expected %q, got %q", s, got)
+				}
+			}
+		})
+
+		it("should escape quotes, backslashes and control characters", func() {
+			got := jsonString("\"\\\n\t\x01café")
+			if diff := cmp.Diff(got, `"\"\\\n\t\u0001caf`+"é"+`"`); diff != "" {
+				t.Fatalf("output did not match: (-got +want)\n%s\n", diff)
+			}
+		})
+	})
+
+	when("--cnb-list-processes --json", func() {
+		it("should print the processes as a JSON array", func() {
+			ok, err := introspect(launcher, []string{"--cnb-list-processes", "--json"}, &out)
+			if !ok || err != nil {
+				t.Fatalf("expected introspection to succeed: %t, %v", ok, err)
+			}
+
+			if diff := cmp.Diff(out.String(), `[
+  {"type": "web", "command": "run", "args": ["say \"hi\"", "a\\b"], "direct": true},
+  {"type": "worker", "command": "work\tnow", "args": [], "direct": false}
+]
+`); diff != "" {
+				t.Fatalf("output did not match: (-got +want)\n%s\n", diff)
+			}
+			var processes []struct {
+				Type    string   `json:"type"`
+				Command string   `json:"command"`
+				Args    []string `json:"args"`
+				Direct  bool     `json:"direct"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &processes); err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		it("should print an empty array if there are no processes", func() {
+			launcher.Processes = nil
+			if _, err := introspect(launcher, []string{"--cnb-list-processes", "--json"}, &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(out.String(), "[]\n"); diff != "" {
+				t.Fatalf("output did not match: (-got +want)\n%s\n", diff)
+			}
+		})
+	})
+
+	when("--cnb-env --json", func() {
+		it("should print the env as a sorted JSON object", func() {
+			ok, err := introspect(launcher, []string{"--cnb-env", "worker", "--json"}, &out)
+			if !ok || err != nil {
+				t.Fatalf("expected introspection to succeed: %t, %v", ok, err)
+			}
+
+			if diff := cmp.Diff(out.String(), `{
+  "A": "\u0001caf`+"é 日本"+`",
+  "B": "line\nbreak"
+}
+`); diff != "" {
+				t.Fatalf("output did not match: (-got +want)\n%s\n", diff)
+			}
+			var vars map[string]string
+			if err := json.Unmarshal(out.Bytes(), &vars); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(vars, map[string]string{
+				"A": "\x01café 日本",
+				"B": "line\nbreak",
+			}); diff != "" {
+				t.Fatalf("env did not match: (-got +want)\n%s\n", diff)
+			}
+		})
+	})
+
+	it("should ignore other arguments", func() {
+		if ok, _ := introspect(launcher, []string{"web"}, &out); ok {
+			t.Fatal("expected the arguments not to be an introspection command")
+		}
+	})
+}
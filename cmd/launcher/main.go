@@ -1,10 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 
 	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
 
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/env"
@@ -34,19 +39,90 @@ func runLaunch() error {
 		return cmd.FailErr(err, "read metadata")
 	}
 
+	envv := env.NewLaunchEnv(os.Environ())
+	envv.Expand, _ = strconv.ParseBool(os.Getenv(cmd.EnvExpandEnv))
+	execFn := syscall.Exec
+	init, _ := strconv.ParseBool(os.Getenv(cmd.EnvLaunchInit))
+	if init {
+		execFn = initExec
+	}
+	if debug, _ := strconv.ParseBool(os.Getenv(cmd.EnvLaunchDebug)); debug {
+		envv.RecordProvenance()
+		label := launch.LayerLabel(absPath(layersDir), md.Buildpacks)
+		baseExec := execFn
+		execFn = func(argv0 string, argv []string, envList []string) error {
+			printProvenance(envv, label)
+			return baseExec(argv0, argv, envList)
+		}
+	}
+
 	launcher := &launch.Launcher{
 		DefaultProcessType: defaultProcessType,
 		LayersDir:          layersDir,
 		AppDir:             appDir,
 		Processes:          md.Processes,
 		Buildpacks:         md.Buildpacks,
-		Env:                env.NewLaunchEnv(os.Environ()),
-		Exec:               syscall.Exec,
+		Env:                envv,
+		Exec:               execFn,
 		Setenv:             os.Setenv,
+		Init:               init,
+	}
+
+	if ok, err := introspect(launcher, os.Args[1:], os.Stdout); ok {
+		return err
+	}
+
+	if types := strings.Split(defaultProcessType, ","); len(os.Args) == 1 && len(types) > 1 {
+		self, err := os.Executable()
+		if err != nil {
+			return cmd.FailErrCode(err, cmd.CodeFailedLaunch, "find launcher")
+		}
+		status, err := launcher.LaunchAll(self, types, os.Stdout, os.Stderr)
+		if err != nil {
+			return cmd.FailErrCode(err, cmd.CodeFailedLaunch, "launch")
+		}
+		if status != 0 {
+			return cmd.ErrorStatus(status)
+		}
+		return nil
 	}
 
 	if err := launcher.Launch(os.Args[0], os.Args[1:]); err != nil {
+		if status, ok := errors.Cause(err).(cmd.ErrorStatus); ok {
+			return status
+		}
 		return cmd.FailErrCode(err, cmd.CodeFailedLaunch, "launch")
 	}
 	return nil
 }
+
+// initExec runs the process as a child of the launcher and returns its exit
+// status as an error if it failed.
+func initExec(argv0 string, argv []string, envList []string) error {
+	status, err := launch.RunInit(argv0, argv, envList)
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		return cmd.ErrorStatus(status)
+	}
+	return nil
+}
+
+func printProvenance(envv *env.Env, label func(string) string) {
+	lines, err := envv.DescribeProvenance("", label)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to describe env: %s\n", err)
+		return
+	}
+	for _, line := range lines {
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"log"
 	"os"
+	"time"
 
 	"github.com/BurntSushi/toml"
 
 	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/env"
 	"github.com/buildpacks/lifecycle/launch"
@@ -27,6 +29,14 @@ type buildArgs struct {
 	layersDir     string
 	appDir        string
 	platformDir   string
+	timeout       time.Duration
+	logPrefix     bool
+	logTimestamps bool
+	logDir        string
+	logSummary    bool
+	logUsage      bool
+	resume        bool
+	expandEnv     bool
 }
 
 func (b *buildCmd) Init() {
@@ -36,6 +46,14 @@ func (b *buildCmd) Init() {
 	cmd.FlagLayersDir(&b.layersDir)
 	cmd.FlagAppDir(&b.appDir)
 	cmd.FlagPlatformDir(&b.platformDir)
+	cmd.FlagBuildTimeout(&b.timeout)
+	cmd.FlagBuildLogPrefix(&b.logPrefix)
+	cmd.FlagBuildLogTimestamps(&b.logTimestamps)
+	cmd.FlagBuildLogDir(&b.logDir)
+	cmd.FlagBuildLogSummary(&b.logSummary)
+	cmd.FlagLogUsage(&b.logUsage)
+	cmd.FlagBuildResume(&b.resume)
+	cmd.FlagExpandEnv(&b.expandEnv)
 }
 
 func (b *buildCmd) Args(nargs int, args []string) error {
@@ -62,19 +80,37 @@ func (b *buildCmd) Exec() error {
 }
 
 func (ba buildArgs) build(group lifecycle.BuildpackGroup, plan lifecycle.BuildPlan) error {
+	envv := env.NewBuildEnv(os.Environ())
+	envv.Expand = ba.expandEnv
+	if cmd.DebugEnabled() {
+		envv.RecordProvenance()
+	}
 	builder := &lifecycle.Builder{
 		AppDir:        ba.appDir,
 		LayersDir:     ba.layersDir,
 		PlatformDir:   ba.platformDir,
 		BuildpacksDir: ba.buildpacksDir,
-		Env:           env.NewBuildEnv(os.Environ()),
+		Env:           envv,
 		Group:         group,
 		Plan:          plan,
 		Out:           log.New(os.Stdout, "", 0),
 		Err:           log.New(os.Stderr, "", 0),
+		Context:       cmd.SignalContext(),
+		Timeout:       ba.timeout,
+		BuildpackAPI:  api.MustParse(cmd.BuildpackAPI),
+		LogPrefix:     ba.logPrefix,
+		LogTimestamps: ba.logTimestamps,
+		LogDir:        ba.logDir,
+		LogSummary:    ba.logSummary,
+		LogUsage:      ba.logUsage,
+		Resume:        ba.resume,
+		Logger:        cmd.Logger,
 	}
 	md, err := builder.Build()
 	if err != nil {
+		if _, ok := err.(*lifecycle.ErrorIncompatibleAPI); ok {
+			return cmd.FailErrCode(err, cmd.CodeIncompatibleBuildpack, "build")
+		}
 		return cmd.FailErrCode(err, cmd.CodeFailedBuild, "build")
 	}
 
@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/docker/docker/client"
 
+	"github.com/buildpacks/lifecycle"
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/image"
 	"github.com/buildpacks/lifecycle/priv"
@@ -31,6 +33,18 @@ type createCmd struct {
 	useDaemon           bool
 	projectMetadataPath string
 	processType         string
+	detectTimeout       time.Duration
+	buildTimeout        time.Duration
+	detectConcurrency   int
+	forceDetect         bool
+	preBuildpacks       cmd.StringSlice
+	postBuildpacks      cmd.StringSlice
+	buildLogPrefix      bool
+	buildLogTimestamps  bool
+	buildLogDir         string
+	buildLogSummary     bool
+	logUsage            bool
+	expandEnv           bool
 
 	//set if necessary before dropping privileges
 	docker client.CommonAPIClient
@@ -56,6 +70,18 @@ func (c *createCmd) Init() {
 	cmd.FlagTags(&c.additionalTags)
 	cmd.FlagProjectMetadataPath(&c.projectMetadataPath)
 	cmd.FlagProcessType(&c.processType)
+	cmd.FlagDetectTimeout(&c.detectTimeout)
+	cmd.FlagBuildTimeout(&c.buildTimeout)
+	cmd.FlagDetectConcurrency(&c.detectConcurrency)
+	cmd.FlagForceDetect(&c.forceDetect)
+	cmd.FlagPreBuildpacks(&c.preBuildpacks)
+	cmd.FlagPostBuildpacks(&c.postBuildpacks)
+	cmd.FlagBuildLogPrefix(&c.buildLogPrefix)
+	cmd.FlagBuildLogTimestamps(&c.buildLogTimestamps)
+	cmd.FlagBuildLogDir(&c.buildLogDir)
+	cmd.FlagBuildLogSummary(&c.buildLogSummary)
+	cmd.FlagLogUsage(&c.logUsage)
+	cmd.FlagExpandEnv(&c.expandEnv)
 }
 
 func (c *createCmd) Args(nargs int, args []string) error {
@@ -110,15 +136,32 @@ func (c *createCmd) Exec() error {
 		return err
 	}
 
+	var detectCache *lifecycle.DetectCacheMetadata
+	if cacheStore != nil {
+		detectCache, err = retrieveDetectCache(cacheStore)
+		if err != nil {
+			cmd.Logger.Warnf("Not using cached detection results: %s", err)
+			detectCache = nil
+		}
+	}
+
 	cmd.Logger.Info("---> DETECTING")
 	group, plan, err := detectArgs{
-		buildpacksDir: c.buildpacksDir,
-		appDir:        c.appDir,
-		platformDir:   c.platformDir,
-		orderPath:     c.orderPath,
+		buildpacksDir:  c.buildpacksDir,
+		appDir:         c.appDir,
+		platformDir:    c.platformDir,
+		orderPath:      c.orderPath,
+		stackPath:      c.stackPath,
+		timeout:        c.detectTimeout,
+		concurrency:    c.detectConcurrency,
+		forceDetect:    c.forceDetect,
+		preBuildpacks:  c.preBuildpacks,
+		postBuildpacks: c.postBuildpacks,
+		detectCache:    detectCache,
+		logUsage:       c.logUsage,
 	}.detect()
 	if err != nil {
-		return cmd.FailErrCode(err, cmd.CodeFailed, "detect")
+		return cmd.FailErr(err, "detect")
 	}
 
 	cmd.Logger.Info("---> ANALYZING")
@@ -146,6 +189,13 @@ func (c *createCmd) Exec() error {
 		layersDir:     c.layersDir,
 		appDir:        c.appDir,
 		platformDir:   c.platformDir,
+		timeout:       c.buildTimeout,
+		logPrefix:     c.buildLogPrefix,
+		logTimestamps: c.buildLogTimestamps,
+		logDir:        c.buildLogDir,
+		logSummary:    c.buildLogSummary,
+		logUsage:      c.logUsage,
+		expandEnv:     c.expandEnv,
 	}.build(group, plan)
 	if err != nil {
 		return err
@@ -166,5 +216,6 @@ func (c *createCmd) Exec() error {
 		gid:                 c.gid,
 		processType:         c.processType,
 		docker:              c.docker,
+		detectCache:         detectCache,
 	}.export(group, cacheStore, analyzedMD)
 }
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
 
 	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
 	"github.com/buildpacks/lifecycle/cmd"
 	"github.com/buildpacks/lifecycle/env"
 	"github.com/buildpacks/lifecycle/priv"
@@ -17,14 +24,30 @@ type detectCmd struct {
 	// flags: paths to write outputs
 	groupPath string
 	planPath  string
+
+	// flags: cache to read detection results from
+	cacheImageTag string
+	cacheDir      string
 }
 
 type detectArgs struct {
 	// inputs needed when run by creator
-	buildpacksDir string
-	appDir        string
-	platformDir   string
-	orderPath     string
+	buildpacksDir  string
+	appDir         string
+	platformDir    string
+	orderPath      string
+	stackPath      string
+	reportPath     string
+	planGraphPath  string
+	timeout        time.Duration
+	concurrency    int
+	forceDetect    bool
+	logUsage       bool
+	preBuildpacks  cmd.StringSlice
+	postBuildpacks cmd.StringSlice
+
+	// detection results from and for the cache
+	detectCache *lifecycle.DetectCacheMetadata
 }
 
 func (d *detectCmd) Init() {
@@ -32,8 +55,19 @@ func (d *detectCmd) Init() {
 	cmd.FlagAppDir(&d.appDir)
 	cmd.FlagPlatformDir(&d.platformDir)
 	cmd.FlagOrderPath(&d.orderPath)
+	cmd.FlagStackPath(&d.stackPath)
 	cmd.FlagGroupPath(&d.groupPath)
 	cmd.FlagPlanPath(&d.planPath)
+	cmd.FlagDetectReportPath(&d.reportPath)
+	cmd.FlagPlanGraphPath(&d.planGraphPath)
+	cmd.FlagDetectTimeout(&d.timeout)
+	cmd.FlagDetectConcurrency(&d.concurrency)
+	cmd.FlagPreBuildpacks(&d.preBuildpacks)
+	cmd.FlagPostBuildpacks(&d.postBuildpacks)
+	cmd.FlagLogUsage(&d.logUsage)
+	cmd.FlagCacheImage(&d.cacheImageTag)
+	cmd.FlagCacheDir(&d.cacheDir)
+	cmd.FlagForceDetect(&d.forceDetect)
 }
 
 func (d *detectCmd) Args(nargs int, args []string) error {
@@ -52,11 +86,29 @@ func (d *detectCmd) Privileges() error {
 }
 
 func (d *detectCmd) Exec() error {
+	// the cache only speeds up detection, so it is not required
+	cacheStore, err := initCache(d.cacheImageTag, d.cacheDir)
+	if err == nil && cacheStore != nil {
+		d.detectCache, err = retrieveDetectCache(cacheStore)
+	}
+	if err != nil {
+		cmd.Logger.Warnf("Not using cached detection results: %s", err)
+		d.detectCache = nil
+	}
+
 	group, plan, err := d.detect()
 	if err != nil {
 		return err
 	}
-	return d.writeData(group, plan)
+	if err := d.writeData(group, plan); err != nil {
+		return err
+	}
+	if d.detectCache != nil {
+		if err := writeDetectCache(detectCachePath(d.groupPath), d.detectCache); err != nil {
+			return cmd.FailErr(err, "write detection results for cache")
+		}
+	}
+	return nil
 }
 
 func (da detectArgs) detect() (lifecycle.BuildpackGroup, lifecycle.BuildPlan, error) {
@@ -65,11 +117,29 @@ func (da detectArgs) detect() (lifecycle.BuildpackGroup, lifecycle.BuildPlan, er
 		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(err, "read buildpack order file")
 	}
 
+	extensions, err := readOrderExtensions(da.orderPath, da.preBuildpacks, da.postBuildpacks)
+	if err != nil {
+		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(err, "read buildpack order file")
+	}
+
+	mixins, err := readStackMixins(da.stackPath)
+	if err != nil {
+		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(err, "read stack file")
+	}
+
 	envv := env.NewBuildEnv(os.Environ())
 	fullEnv, err := envv.WithPlatform(da.platformDir)
 	if err != nil {
 		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(err, "read full env")
 	}
+	var report *lifecycle.DetectReport
+	if da.reportPath != "" {
+		report = &lifecycle.DetectReport{}
+	}
+	var graph *lifecycle.PlanGraph
+	if da.planGraphPath != "" {
+		graph = &lifecycle.PlanGraph{}
+	}
 	group, plan, err := order.Detect(&lifecycle.DetectConfig{
 		FullEnv:       fullEnv,
 		ClearEnv:      envv.List(),
@@ -77,12 +147,43 @@ func (da detectArgs) detect() (lifecycle.BuildpackGroup, lifecycle.BuildPlan, er
 		PlatformDir:   da.platformDir,
 		BuildpacksDir: da.buildpacksDir,
 		Logger:        cmd.Logger,
+		Report:        report,
+		PlanGraph:     graph,
+		Context:       cmd.SignalContext(),
+		Timeout:       da.timeout,
+		Concurrency:   da.concurrency,
+		BuildpackAPI:  api.MustParse(cmd.BuildpackAPI),
+		StackID:       os.Getenv(cmd.EnvStackID),
+		Mixins:        mixins,
+		Extensions:    extensions,
+		Cache:         da.detectCache,
+		ForceDetect:   da.forceDetect,
+		LogUsage:      da.logUsage,
 	})
+	if report != nil {
+		if rErr := writeReport(da.reportPath, report); rErr != nil {
+			if err == nil {
+				return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(rErr, "write detect report")
+			}
+			cmd.Logger.Warnf("Failed to write detect report: %s", rErr)
+		}
+	}
+	if graph != nil && err == nil {
+		if err := writePlanGraph(da.planGraphPath, graph); err != nil {
+			return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErr(err, "write plan graph")
+		}
+	}
 	if err != nil {
 		if err == lifecycle.ErrFail {
 			cmd.Logger.Error("No buildpack groups passed detection.")
 			cmd.Logger.Error("Please check that you are running against the correct path.")
 		}
+		if _, ok := err.(*lifecycle.ErrorCycle); ok {
+			return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErrCode(err, cmd.CodeCyclicOrder, "detect")
+		}
+		if _, ok := err.(*lifecycle.ErrorIncompatibleAPI); ok {
+			return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErrCode(err, cmd.CodeIncompatibleBuildpack, "detect")
+		}
 		return lifecycle.BuildpackGroup{}, lifecycle.BuildPlan{}, cmd.FailErrCode(err, cmd.CodeFailedDetect, "detect")
 	}
 
@@ -99,3 +200,62 @@ func (d *detectCmd) writeData(group lifecycle.BuildpackGroup, plan lifecycle.Bui
 	}
 	return nil
 }
+
+func writeReport(path string, report *lifecycle.DetectReport) error {
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		return lifecycle.WriteTOML(path, report)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func writePlanGraph(path string, graph *lifecycle.PlanGraph) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		return graph.WriteDOT(f)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(graph)
+}
+
+// readOrderExtensions returns the buildpacks from the order file's
+// [[order-extensions]] followed by those given as <id>[@<version>][?] references.
+func readOrderExtensions(orderPath string, pre, post []string) (lifecycle.OrderExtensions, error) {
+	ext, err := lifecycle.ReadOrderExtensions(orderPath)
+	if err != nil {
+		return lifecycle.OrderExtensions{}, err
+	}
+	return ext.Append(lifecycle.OrderExtensions{
+		Pre:  lifecycle.ParseBuildpackRefs(pre),
+		Post: lifecycle.ParseBuildpackRefs(post),
+	}), nil
+}
+
+func readStackMixins(path string) ([]string, error) {
+	var stack struct {
+		Mixins []string `toml:"mixins"`
+	}
+	if _, err := toml.DecodeFile(path, &stack); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return stack.Mixins, nil
+}
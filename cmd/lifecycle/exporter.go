@@ -46,6 +46,7 @@ type exportArgs struct {
 	useDaemon           bool
 	uid, gid            int
 	processType         string
+	detectCache         *lifecycle.DetectCacheMetadata
 
 	//construct if necessary before dropping privileges
 	docker client.CommonAPIClient
@@ -133,6 +134,11 @@ func (e *exportCmd) Exec() error {
 		cmd.Logger.Infof("no stack metadata found at path '%s', stack metadata will not be exported\n", e.stackPath)
 	}
 
+	e.detectCache, err = readDetectCache(detectCachePath(e.groupPath))
+	if err != nil {
+		return cmd.FailErr(err, "read detection results for cache")
+	}
+
 	return e.export(group, cacheStore, analyzedMD)
 }
 
@@ -169,6 +175,7 @@ func (ea exportArgs) export(group lifecycle.BuildpackGroup, cacheStore lifecycle
 		UID:          ea.uid,
 		GID:          ea.gid,
 		ArtifactsDir: artifactsDir,
+		DetectCache:  ea.detectCache,
 	}
 
 	var appImage imgutil.Image
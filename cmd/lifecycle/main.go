@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -30,6 +32,8 @@ func main() {
 		cmd.Run(&rebaseCmd{}, false)
 	case "creator":
 		cmd.Run(&createCmd{}, false)
+	case "validator":
+		cmd.Run(&validateCmd{}, false)
 	default:
 		if len(os.Args) < 2 {
 			cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "parse arguments"))
@@ -58,11 +62,55 @@ func subcommand() {
 		cmd.Run(&rebaseCmd{}, true)
 	case "create":
 		cmd.Run(&createCmd{}, true)
+	case "validate":
+		cmd.Run(&validateCmd{}, true)
 	default:
 		cmd.Exit(cmd.FailCode(cmd.CodeInvalidArgs, "unknown phase:", phase))
 	}
 }
 
+// retrieveDetectCache returns the detection results recorded in the cache,
+// which are updated by detection and saved with the cache on export.
+func retrieveDetectCache(cacheStore lifecycle.Cache) (*lifecycle.DetectCacheMetadata, error) {
+	cacheMD, err := cacheStore.RetrieveMetadata()
+	if err != nil {
+		return nil, cmd.FailErr(err, "retrieve cache metadata")
+	}
+	if cacheMD.Detect == nil {
+		return &lifecycle.DetectCacheMetadata{}, nil
+	}
+	return cacheMD.Detect, nil
+}
+
+// detectCachePath returns the path where the detector leaves the detection
+// results for the exporter to save with the cache.
+func detectCachePath(groupPath string) string {
+	return filepath.Join(filepath.Dir(groupPath), "detect-cache.json")
+}
+
+func writeDetectCache(path string, detectCache *lifecycle.DetectCacheMetadata) error {
+	data, err := json.Marshal(detectCache)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
+
+// readDetectCache returns nil if the detector did not leave detection results.
+func readDetectCache(path string) (*lifecycle.DetectCacheMetadata, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var detectCache lifecycle.DetectCacheMetadata
+	if err := json.Unmarshal(data, &detectCache); err != nil {
+		return nil, err
+	}
+	return &detectCache, nil
+}
+
 func initCache(cacheImageTag, cacheDir string) (lifecycle.Cache, error) {
 	var (
 		cacheStore lifecycle.Cache
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/cmd"
+)
+
+type validateCmd struct {
+	// flags: inputs
+	buildpacksDir  string
+	orderPath      string
+	preBuildpacks  cmd.StringSlice
+	postBuildpacks cmd.StringSlice
+}
+
+func (v *validateCmd) Init() {
+	cmd.FlagBuildpacksDir(&v.buildpacksDir)
+	cmd.FlagOrderPath(&v.orderPath)
+	cmd.FlagPreBuildpacks(&v.preBuildpacks)
+	cmd.FlagPostBuildpacks(&v.postBuildpacks)
+}
+
+func (v *validateCmd) Args(nargs int, args []string) error {
+	if nargs != 0 {
+		return cmd.FailErrCode(errors.New("received unexpected arguments"), cmd.CodeInvalidArgs, "parse arguments")
+	}
+	return nil
+}
+
+func (v *validateCmd) Privileges() error {
+	return nil
+}
+
+func (v *validateCmd) Exec() error {
+	var orderTOML struct {
+		Order      lifecycle.BuildpackOrder    `toml:"order"`
+		Extensions []lifecycle.OrderExtensions `toml:"order-extensions"`
+	}
+	md, err := toml.DecodeFile(v.orderPath, &orderTOML)
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeFailedValidation, "read buildpack order file")
+	}
+
+	extensions, err := readOrderExtensions(v.orderPath, v.preBuildpacks, v.postBuildpacks)
+	if err != nil {
+		return cmd.FailErrCode(err, cmd.CodeFailedValidation, "read buildpack order file")
+	}
+
+	var errs []error
+	for _, key := range md.Undecoded() {
+		errs = append(errs, fmt.Errorf("%s: unknown key '%s'", v.orderPath, key))
+	}
+	errs = append(errs, orderTOML.Order.Validate(&lifecycle.ValidateConfig{
+		BuildpacksDir: v.buildpacksDir,
+		BuildpackAPI:  api.MustParse(cmd.BuildpackAPI),
+		Extensions:    extensions,
+	})...)
+
+	for _, err := range errs {
+		cmd.Logger.Error(err.Error())
+	}
+	if len(errs) > 0 {
+		return cmd.FailErrCode(fmt.Errorf("found %d problem(s)", len(errs)), cmd.CodeFailedValidation, "validate")
+	}
+	cmd.Logger.Infof("Order %s is valid", v.orderPath)
+	return nil
+}
@@ -35,6 +35,11 @@ func SetLogLevel(level string) *ErrorFail {
 	return nil
 }
 
+// DebugEnabled returns true if debug messages will be logged.
+func DebugEnabled() bool {
+	return Logger.Level <= log.DebugLevel
+}
+
 type handler struct {
 	mu     sync.Mutex
 	writer io.Writer
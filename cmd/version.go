@@ -17,6 +17,8 @@ var (
 	SCMRepository = ""
 	// PlatformAPI is the version of the Platform API implemented.
 	PlatformAPI = "0.0"
+	// BuildpackAPI is the version of the Buildpack API implemented.
+	BuildpackAPI = "0.2"
 )
 
 // buildVersion is a display format of the version and build metadata in compliance with semver.
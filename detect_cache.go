@@ -0,0 +1,187 @@
+package lifecycle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DetectCacheMetadata records the outcome of each bin/detect so that detection
+// can be replayed by a later build with the same inputs. Only the exit code
+// and plan of each run are kept, since the metadata is stored as a label on
+// cache images.
+type DetectCacheMetadata struct {
+	Key  string           `json:"key"`
+	Runs []DetectCacheRun `json:"runs,omitempty"`
+}
+
+type DetectCacheRun struct {
+	Buildpack Buildpack         `json:"buildpack"`
+	Code      int               `json:"code"`
+	Requires  []Require         `json:"requires,omitempty"`
+	Provides  []Provide         `json:"provides,omitempty"`
+	Or        []DetectCachePlan `json:"or,omitempty"`
+}
+
+type DetectCachePlan struct {
+	Requires []Require `json:"requires,omitempty"`
+	Provides []Provide `json:"provides,omitempty"`
+}
+
+// detectCached replays the cached runs if they were recorded with the same key,
+// so that the report and plan graph are produced without running bin/detect.
+func (bo BuildpackOrder) detectCached(c *DetectConfig, detect func() ([]Buildpack, []BuildPlanEntry, error)) ([]Buildpack, []BuildPlanEntry, error) {
+	key, err := bo.detectCacheKey(c)
+	if err != nil {
+		c.Logger.Warnf("Not using cached detection results: %s", err)
+		*c.Cache = DetectCacheMetadata{}
+		return detect()
+	}
+	if !c.ForceDetect && c.Cache.Key == key {
+		c.Logger.Info("Reusing cached detection results")
+		for _, run := range c.Cache.Runs {
+			c.runs.Store(run.Buildpack.String(), run.detectRun())
+		}
+		return detect()
+	}
+
+	group, entries, err := detect()
+	if err != nil {
+		*c.Cache = DetectCacheMetadata{}
+		return nil, nil, err
+	}
+	*c.Cache = DetectCacheMetadata{
+		Key:  key,
+		Runs: c.cacheRuns(),
+	}
+	return group, entries, nil
+}
+
+func (c *DetectConfig) cacheRuns() []DetectCacheRun {
+	var runs []DetectCacheRun
+	c.runs.Range(func(k, v interface{}) bool {
+		run := v.(detectRun)
+		if run.Err != nil || run.Code != CodeDetectPass && run.Code != CodeDetectFail {
+			// errors and timeouts may not recur, so run bin/detect again next time
+			return true
+		}
+		id := strings.SplitN(k.(string), "@", 2)
+		out := DetectCacheRun{
+			Buildpack: Buildpack{ID: id[0], Version: id[1]},
+			Code:      run.Code,
+			Requires:  run.Requires,
+			Provides:  run.Provides,
+		}
+		for _, or := range run.Or {
+			out.Or = append(out.Or, DetectCachePlan{Requires: or.Requires, Provides: or.Provides})
+		}
+		runs = append(runs, out)
+		return true
+	})
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Buildpack.String() < runs[j].Buildpack.String()
+	})
+	return runs
+}
+
+func (r DetectCacheRun) detectRun() detectRun {
+	run := detectRun{
+		planSections: planSections{Requires: r.Requires, Provides: r.Provides},
+		Code:         r.Code,
+	}
+	for _, or := range r.Or {
+		run.Or = append(run.Or, planSections{Requires: or.Requires, Provides: or.Provides})
+	}
+	return run
+}
+
+// detectCacheKey hashes every input to detection: the app directory, the
+// platform env directory, the stack, and the resolved version of every
+// buildpack reachable from the order.
+func (bo BuildpackOrder) detectCacheKey(c *DetectConfig) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "stack %q %q\n", c.StackID, c.Mixins)
+	if c.BuildpackAPI != nil {
+		fmt.Fprintf(h, "api %s\n", c.BuildpackAPI)
+	}
+	if err := bo.hashBuildpacks(h, nil, c.BuildpacksDir); err != nil {
+		return "", errors.Wrap(err, "hash buildpacks")
+	}
+	if err := hashDir(h, "app", c.AppDir); err != nil {
+		return "", errors.Wrap(err, "hash app directory")
+	}
+	if err := hashDir(h, "env", filepath.Join(c.PlatformDir, "env")); err != nil {
+		return "", errors.Wrap(err, "hash platform env directory")
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+func (bo BuildpackOrder) hashBuildpacks(h hash.Hash, path detectPath, buildpacksDir string) error {
+	for i, group := range bo {
+		fmt.Fprintf(h, "group %d\n", i)
+		for _, bp := range group.Group {
+			resolved, err := bp.resolve(buildpacksDir)
+			if err != nil {
+				return err
+			}
+			info, err := resolved.lookup(buildpacksDir)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "buildpack %s %t %s\n", resolved.noOpt(), bp.Optional, info.API)
+			if info.Order != nil {
+				next, err := path.expand(resolved)
+				if err != nil {
+					return err
+				}
+				if err := info.Order.hashBuildpacks(h, next, buildpacksDir); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hashDir(h hash.Hash, name, dir string) error {
+	fmt.Fprintf(h, "dir %s\n", name)
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%q %s\n", filepath.ToSlash(rel), fi.Mode())
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "-> %q\n", target)
+		case fi.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fmt.Fprintf(h, "%d\n", fi.Size())
+			if _, err := io.Copy(h, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,119 @@
+package lifecycle
+
+// DetectReport is a machine-readable account of every group and trial
+// evaluated during detection.
+type DetectReport struct {
+	Groups []DetectReportGroup `toml:"groups" json:"groups"`
+}
+
+type DetectReportGroup struct {
+	Buildpacks []DetectReportBuildpack `toml:"buildpacks" json:"buildpacks"`
+	Trials     []DetectReportTrial     `toml:"trials,omitempty" json:"trials,omitempty"`
+	Pass       bool                    `toml:"pass" json:"pass"`
+}
+
+type DetectReportBuildpack struct {
+	Buildpack Buildpack      `toml:"buildpack" json:"buildpack"`
+	Result    string         `toml:"result" json:"result"`
+	Code      int            `toml:"code" json:"code"`
+	Output    string         `toml:"output,omitempty" json:"output,omitempty"`
+	Error     string         `toml:"error,omitempty" json:"error,omitempty"`
+	Usage     *ResourceUsage `toml:"usage,omitempty" json:"usage,omitempty"`
+}
+
+type DetectReportTrial struct {
+	Options    []DetectReportOption      `toml:"options" json:"options"`
+	Eliminated []DetectReportElimination `toml:"eliminated,omitempty" json:"eliminated,omitempty"`
+	Pass       bool                      `toml:"pass" json:"pass"`
+}
+
+type DetectReportOption struct {
+	Buildpack Buildpack `toml:"buildpack" json:"buildpack"`
+	Requires  []Require `toml:"requires,omitempty" json:"requires,omitempty"`
+	Provides  []Provide `toml:"provides,omitempty" json:"provides,omitempty"`
+}
+
+type DetectReportElimination struct {
+	Buildpack Buildpack `toml:"buildpack" json:"buildpack"`
+	Reason    string    `toml:"reason" json:"reason"`
+	Name      string    `toml:"name" json:"name"`
+}
+
+const (
+	reportResultPass  = "pass"
+	reportResultFail  = "fail"
+	reportResultSkip  = "skip"
+	reportResultError = "error"
+
+	reportReasonRequires = "requires"
+	reportReasonProvides = "provides unused"
+)
+
+// The methods below are safe to call on a nil receiver so that detection
+// does not need to check whether a report was requested.
+
+func (r *DetectReport) group() *DetectReportGroup {
+	if r == nil {
+		return nil
+	}
+	r.Groups = append(r.Groups, DetectReportGroup{})
+	return &r.Groups[len(r.Groups)-1]
+}
+
+func (g *DetectReportGroup) buildpack(bp Buildpack, run detectRun, result string) {
+	if g == nil {
+		return
+	}
+	out := DetectReportBuildpack{
+		Buildpack: bp,
+		Result:    result,
+		Code:      run.Code,
+		Output:    string(run.Output),
+		Usage:     run.Usage,
+	}
+	if run.Err != nil {
+		out.Error = run.Err.Error()
+	}
+	g.Buildpacks = append(g.Buildpacks, out)
+}
+
+func (g *DetectReportGroup) pass() {
+	if g == nil {
+		return
+	}
+	g.Pass = true
+}
+
+func (g *DetectReportGroup) trial(trial detectTrial) *DetectReportTrial {
+	if g == nil {
+		return nil
+	}
+	var options []DetectReportOption
+	for _, option := range trial {
+		options = append(options, DetectReportOption{
+			Buildpack: option.Buildpack,
+			Requires:  option.Requires,
+			Provides:  option.Provides,
+		})
+	}
+	g.Trials = append(g.Trials, DetectReportTrial{Options: options})
+	return &g.Trials[len(g.Trials)-1]
+}
+
+func (t *DetectReportTrial) eliminate(bp Buildpack, reason, name string) {
+	if t == nil {
+		return
+	}
+	t.Eliminated = append(t.Eliminated, DetectReportElimination{
+		Buildpack: bp,
+		Reason:    reason,
+		Name:      name,
+	})
+}
+
+func (t *DetectReportTrial) pass() {
+	if t == nil {
+		return
+	}
+	t.Pass = true
+}
@@ -2,16 +2,23 @@ package lifecycle
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/api"
+	"github.com/buildpacks/lifecycle/semver"
 )
 
 const (
@@ -21,6 +28,20 @@ const (
 
 var ErrFail = errors.New("no buildpacks participating")
 
+// ErrorCycle is returned when a buildpack order references itself through
+// one or more order-containing buildpacks.
+type ErrorCycle struct {
+	Cycle []Buildpack
+}
+
+func (e *ErrorCycle) Error() string {
+	var ids []string
+	for _, bp := range e.Cycle {
+		ids = append(ids, bp.String())
+	}
+	return "cyclic buildpack order: " + strings.Join(ids, " -> ")
+}
+
 type BuildPlan struct {
 	Entries []BuildPlanEntry `toml:"entries"`
 }
@@ -46,7 +67,8 @@ type Require struct {
 }
 
 type Provide struct {
-	Name string `toml:"name"`
+	Name    string `toml:"name" json:"name"`
+	Version string `toml:"version,omitempty" json:"version,omitempty"`
 }
 
 type DetectConfig struct {
@@ -56,7 +78,34 @@ type DetectConfig struct {
 	PlatformDir   string
 	BuildpacksDir string
 	Logger        Logger
+	Report        *DetectReport
+	PlanGraph     *PlanGraph
+	Context       context.Context
+	Timeout       time.Duration
+	Concurrency   int
+	BuildpackAPI  *api.Version
+	StackID       string
+	Mixins        []string
+	Extensions    OrderExtensions
+	Cache         *DetectCacheMetadata // if set, results are reused when the key matches and updated otherwise
+	ForceDetect   bool
+	LogUsage      bool // log the resources used by each buildpack's bin/detect, ranked by wall time
 	runs          *sync.Map
+	workers       chan struct{}
+	incompatible  error // the first required buildpack with an incompatible Buildpack API, returned if no group passes
+}
+
+func (c *DetectConfig) init() {
+	if c.runs == nil {
+		c.runs = &sync.Map{}
+	}
+	if c.workers == nil {
+		n := c.Concurrency
+		if n <= 0 {
+			n = runtime.NumCPU()
+		}
+		c.workers = make(chan struct{}, n)
+	}
 }
 
 func (c *DetectConfig) process(done []Buildpack) ([]Buildpack, []BuildPlanEntry, error) {
@@ -80,6 +129,7 @@ func (c *DetectConfig) process(done []Buildpack) ([]Buildpack, []BuildPlanEntry,
 
 	c.Logger.Debugf("======== Results ========")
 
+	report := c.Report.group()
 	results := detectResults{}
 	detected := true
 	for i, bp := range done {
@@ -87,19 +137,24 @@ func (c *DetectConfig) process(done []Buildpack) ([]Buildpack, []BuildPlanEntry,
 		switch run.Code {
 		case CodeDetectPass:
 			c.Logger.Debugf("pass: %s", bp)
+			report.buildpack(bp, run, reportResultPass)
 			results = append(results, detectResult{bp, run})
 		case CodeDetectFail:
 			if bp.Optional {
 				c.Logger.Debugf("skip: %s", bp)
+				report.buildpack(bp, run, reportResultSkip)
 			} else {
 				c.Logger.Debugf("fail: %s", bp)
+				report.buildpack(bp, run, reportResultFail)
 			}
 			detected = detected && bp.Optional
 		case -1:
 			c.Logger.Debugf("err:  %s", bp)
+			report.buildpack(bp, run, reportResultError)
 			detected = detected && bp.Optional
 		default:
 			c.Logger.Debugf("err:  %s (%d)", bp, run.Code)
+			report.buildpack(bp, run, reportResultError)
 			detected = detected && bp.Optional
 		}
 	}
@@ -108,13 +163,28 @@ func (c *DetectConfig) process(done []Buildpack) ([]Buildpack, []BuildPlanEntry,
 	}
 
 	i := 0
+	var options detectTrial
+	var eliminated []PlanGraphNode
 	deps, trial, err := results.runTrials(func(trial detectTrial) (depMap, detectTrial, error) {
 		i++
-		return c.runTrial(i, trial)
+		options, eliminated = trial, nil
+		trialReport := report.trial(trial)
+		deps, passed, err := c.runTrial(i, trial, func(bp Buildpack, reason, name string) {
+			trialReport.eliminate(bp, reason, name)
+			eliminated = append(eliminated, PlanGraphNode{Buildpack: bp, Eliminated: true, Reason: reason, Name: name})
+		})
+		if err == nil {
+			trialReport.pass()
+		}
+		return deps, passed, err
 	})
 	if err != nil {
 		return nil, nil, err
 	}
+	report.pass()
+	if c.PlanGraph != nil {
+		c.PlanGraph.set(options, eliminated, deps)
+	}
 
 	if len(done) != len(trial) {
 		c.Logger.Infof("%d of %d buildpacks participating", len(trial), len(done))
@@ -145,7 +215,7 @@ func (c *DetectConfig) process(done []Buildpack) ([]Buildpack, []BuildPlanEntry,
 	return found, plan, nil
 }
 
-func (c *DetectConfig) runTrial(i int, trial detectTrial) (depMap, detectTrial, error) {
+func (c *DetectConfig) runTrial(i int, trial detectTrial, eliminate func(bp Buildpack, reason, name string)) (depMap, detectTrial, error) {
 	c.Logger.Debugf("Resolving plan... (try #%d)", i)
 
 	var deps depMap
@@ -156,6 +226,7 @@ func (c *DetectConfig) runTrial(i int, trial detectTrial) (depMap, detectTrial,
 
 		if err := deps.eachUnmetRequire(func(name string, bp Buildpack) error {
 			retry = true
+			eliminate(bp, reportReasonRequires, name)
 			if !bp.Optional {
 				c.Logger.Debugf("fail: %s requires %s", bp, name)
 				return ErrFail
@@ -169,6 +240,7 @@ func (c *DetectConfig) runTrial(i int, trial detectTrial) (depMap, detectTrial,
 
 		if err := deps.eachUnmetProvide(func(name string, bp Buildpack) error {
 			retry = true
+			eliminate(bp, reportReasonProvides, name)
 			if !bp.Optional {
 				c.Logger.Debugf("fail: %s provides unused %s", bp, name)
 				return ErrFail
@@ -189,6 +261,9 @@ func (c *DetectConfig) runTrial(i int, trial detectTrial) (depMap, detectTrial,
 }
 
 func (bp *buildpackTOML) Detect(c *DetectConfig) detectRun {
+	if err := bp.verifyStack(c.StackID, c.Mixins); err != nil {
+		return detectRun{Code: CodeDetectFail, Err: err}
+	}
 	appDir, err := filepath.Abs(c.AppDir)
 	if err != nil {
 		return detectRun{Code: -1, Err: err}
@@ -217,24 +292,35 @@ func (bp *buildpackTOML) Detect(c *DetectConfig) detectRun {
 	cmd.Dir = appDir
 	cmd.Stdout = out
 	cmd.Stderr = out
-	cmd.Env = c.FullEnv
+	cmd.Env = bp.env(c.FullEnv)
 	if bp.Buildpack.ClearEnv {
-		cmd.Env = c.ClearEnv
+		cmd.Env = bp.env(c.ClearEnv)
+	}
+	if c.BuildpackAPI != nil && bp.API == "" {
+		c.Logger.Warnf("Buildpack %s does not declare a Buildpack API version", bp.info())
 	}
 
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err = runCmd(c.Context, cmd, c.Timeout)
+	usage := processUsage(cmd.ProcessState, time.Since(start))
+	if err != nil {
 		if err, ok := err.(*exec.ExitError); ok {
 			if status, ok := err.Sys().(syscall.WaitStatus); ok {
-				return detectRun{Code: status.ExitStatus(), Output: out.Bytes()}
+				return detectRun{Code: status.ExitStatus(), Output: out.Bytes(), Usage: &usage}
 			}
 		}
-		return detectRun{Code: -1, Err: err, Output: out.Bytes()}
+		runErr := timeoutErr(err, bp.info(), "detection", c.Timeout)
+		if err == context.DeadlineExceeded {
+			c.Logger.Warn(runErr.Error())
+		}
+		return detectRun{Code: -1, Err: runErr, Output: out.Bytes(), Usage: &usage}
 	}
 	var t detectRun
 	if _, err := toml.DecodeFile(planPath, &t); err != nil {
-		return detectRun{Code: -1, Err: err}
+		return detectRun{Code: -1, Err: err, Usage: &usage}
 	}
 	t.Output = out.Bytes()
+	t.Usage = &usage
 	return t
 }
 
@@ -243,33 +329,61 @@ type BuildpackGroup struct {
 }
 
 func (bg BuildpackGroup) Detect(c *DetectConfig) (BuildpackGroup, BuildPlan, error) {
-	if c.runs == nil {
-		c.runs = &sync.Map{}
-	}
-	bps, entries, err := bg.detect(nil, &sync.WaitGroup{}, c)
+	c.init()
+	bps, entries, err := bg.detect(nil, make([]detectPath, len(bg.Group)), &sync.WaitGroup{}, c)
+	c.logUsage()
 	return BuildpackGroup{Group: bps}, BuildPlan{Entries: entries}, err
 }
 
-func (bg BuildpackGroup) detect(done []Buildpack, wg *sync.WaitGroup, c *DetectConfig) ([]Buildpack, []BuildPlanEntry, error) {
+// paths[i] is the chain of order-containing buildpacks expanded to reach bg.Group[i].
+func (bg BuildpackGroup) detect(done []Buildpack, paths []detectPath, wg *sync.WaitGroup, c *DetectConfig) ([]Buildpack, []BuildPlanEntry, error) {
 	for i, bp := range bg.Group {
-		key := bp.String()
 		if hasID(done, bp.ID) {
 			continue
 		}
+		bp, err := bp.resolve(c.BuildpacksDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := bp.String()
 		info, err := bp.lookup(c.BuildpacksDir)
 		if err != nil {
 			return nil, nil, err
 		}
+		if err := info.verifyAPI(c.BuildpackAPI); err != nil {
+			if _, ok := err.(*ErrorIncompatibleAPI); !ok {
+				return nil, nil, err
+			}
+			c.Logger.Warn(err.Error())
+			if !bp.Optional && c.incompatible == nil {
+				c.incompatible = err
+			}
+			if info.Order == nil {
+				done = append(done, bp)
+				c.runs.Store(key, detectRun{Code: CodeDetectFail, Err: err})
+				continue
+			}
+			if bp.Optional {
+				continue
+			}
+			wg.Wait()
+			return nil, nil, ErrFail
+		}
 		if info.Order != nil {
+			path, err := paths[i].expand(bp)
+			if err != nil {
+				return nil, nil, err
+			}
 			// TODO: double-check slice safety here
-			// FIXME: cyclical references lead to infinite recursion
-			return info.Order.detect(done, bg.Group[i+1:], bp.Optional, wg, c)
+			return info.Order.detect(done, bg.Group[i+1:], paths[i+1:], path, bp.Optional, wg, c)
 		}
 		done = append(done, bp)
 		wg.Add(1)
 		go func() {
 			if _, ok := c.runs.Load(key); !ok {
+				c.workers <- struct{}{}
 				c.runs.Store(key, info.Detect(c))
+				<-c.workers
 			}
 			wg.Done()
 		}()
@@ -277,6 +391,9 @@ func (bg BuildpackGroup) detect(done []Buildpack, wg *sync.WaitGroup, c *DetectC
 
 	wg.Wait()
 
+	if c.Context != nil && c.Context.Err() != nil {
+		return nil, nil, c.Context.Err()
+	}
 	return c.process(done)
 }
 
@@ -290,18 +407,37 @@ func (bg BuildpackGroup) append(group ...BuildpackGroup) BuildpackGroup {
 type BuildpackOrder []BuildpackGroup
 
 func (bo BuildpackOrder) Detect(c *DetectConfig) (BuildpackGroup, BuildPlan, error) {
-	if c.runs == nil {
-		c.runs = &sync.Map{}
+	c.init()
+	bo = bo.extend(c.Extensions)
+	detect := func() ([]Buildpack, []BuildPlanEntry, error) {
+		return bo.detect(nil, nil, nil, nil, false, &sync.WaitGroup{}, c)
+	}
+	var (
+		bps     []Buildpack
+		entries []BuildPlanEntry
+		err     error
+	)
+	if c.Cache != nil {
+		bps, entries, err = bo.detectCached(c, detect)
+	} else {
+		bps, entries, err = detect()
+	}
+	if err == ErrFail && c.incompatible != nil {
+		err = c.incompatible
 	}
-	bps, entries, err := bo.detect(nil, nil, false, &sync.WaitGroup{}, c)
+	c.logUsage()
 	return BuildpackGroup{Group: bps}, BuildPlan{Entries: entries}, err
 }
 
-func (bo BuildpackOrder) detect(done, next []Buildpack, optional bool, wg *sync.WaitGroup, c *DetectConfig) ([]Buildpack, []BuildPlanEntry, error) {
+func (bo BuildpackOrder) detect(done, next []Buildpack, nextPaths []detectPath, path detectPath, optional bool, wg *sync.WaitGroup, c *DetectConfig) ([]Buildpack, []BuildPlanEntry, error) {
 	ngroup := BuildpackGroup{Group: next}
 	for _, group := range bo {
+		var paths []detectPath
+		for range group.Group {
+			paths = append(paths, path)
+		}
 		// FIXME: double-check slice safety here
-		found, plan, err := group.append(ngroup).detect(done, wg, c)
+		found, plan, err := group.append(ngroup).detect(done, append(paths, nextPaths...), wg, c)
 		if err == ErrFail {
 			wg = &sync.WaitGroup{}
 			continue
@@ -309,11 +445,53 @@ func (bo BuildpackOrder) detect(done, next []Buildpack, optional bool, wg *sync.
 		return found, plan, err
 	}
 	if optional {
-		return ngroup.detect(done, wg, c)
+		return ngroup.detect(done, nextPaths, wg, c)
 	}
 	return nil, nil, ErrFail
 }
 
+// OrderExtensions are buildpacks supplied by the platform that run before
+// and after the buildpacks of every group in the order.
+type OrderExtensions struct {
+	Pre  []Buildpack `toml:"pre"`
+	Post []Buildpack `toml:"post"`
+}
+
+// Append returns the extensions with the buildpacks of o added after those of e.
+func (e OrderExtensions) Append(o OrderExtensions) OrderExtensions {
+	return OrderExtensions{
+		Pre:  append(append([]Buildpack{}, e.Pre...), o.Pre...),
+		Post: append(append([]Buildpack{}, e.Post...), o.Post...),
+	}
+}
+
+func (bo BuildpackOrder) extend(ext OrderExtensions) BuildpackOrder {
+	if len(ext.Pre) == 0 && len(ext.Post) == 0 {
+		return bo
+	}
+	var out BuildpackOrder
+	for _, group := range bo {
+		pre := BuildpackGroup{Group: append([]Buildpack{}, ext.Pre...)}
+		out = append(out, pre.append(group, BuildpackGroup{Group: ext.Post}))
+	}
+	return out
+}
+
+type detectPath []Buildpack
+
+func (p detectPath) expand(bp Buildpack) (detectPath, error) {
+	for i, parent := range p {
+		if parent.noOpt() == bp.noOpt() {
+			cycle := append(append([]Buildpack{}, p[i:]...), bp)
+			for j := range cycle {
+				cycle[j] = cycle[j].noOpt()
+			}
+			return nil, &ErrorCycle{Cycle: cycle}
+		}
+	}
+	return append(append(detectPath{}, p...), bp), nil
+}
+
 func hasID(bps []Buildpack, id string) bool {
 	for _, bp := range bps {
 		if bp.ID == id {
@@ -329,6 +507,7 @@ type detectRun struct {
 	Output []byte         `toml:"-"`
 	Code   int            `toml:"-"`
 	Err    error          `toml:"-"`
+	Usage  *ResourceUsage `toml:"-"` // nil if bin/detect was not run
 }
 
 type planSections struct {
@@ -395,7 +574,11 @@ func (ts detectTrial) remove(bp Buildpack) detectTrial {
 type depEntry struct {
 	BuildPlanEntry
 	earlyRequires []Buildpack
+	earlyVersions []string
+	requirers     []Buildpack
 	extraProvides []Buildpack
+	extraVersions []string
+	versions      []string
 }
 
 type depMap map[string]depEntry
@@ -416,18 +599,23 @@ func newDepMap(trial detectTrial) depMap {
 func (m depMap) provide(bp Buildpack, provide Provide) {
 	entry := m[provide.Name]
 	entry.extraProvides = append(entry.extraProvides, bp)
+	entry.extraVersions = append(entry.extraVersions, provide.Version)
 	m[provide.Name] = entry
 }
 
 func (m depMap) require(bp Buildpack, require Require) {
 	entry := m[require.Name]
 	entry.Providers = append(entry.Providers, entry.extraProvides...)
+	entry.versions = append(entry.versions, entry.extraVersions...)
 	entry.extraProvides = nil
+	entry.extraVersions = nil
 
-	if len(entry.Providers) == 0 {
+	if len(entry.Providers) == 0 || !entry.satisfies(require.Version) {
 		entry.earlyRequires = append(entry.earlyRequires, bp)
+		entry.earlyVersions = append(entry.earlyVersions, require.Version)
 	} else {
 		entry.Requires = append(entry.Requires, require)
+		entry.requirers = append(entry.requirers, bp)
 	}
 	m[require.Name] = entry
 }
@@ -448,8 +636,12 @@ func (m depMap) eachUnmetProvide(f func(name string, bp Buildpack) error) error
 func (m depMap) eachUnmetRequire(f func(name string, bp Buildpack) error) error {
 	for name, entry := range m {
 		if len(entry.earlyRequires) != 0 {
-			for _, bp := range entry.earlyRequires {
-				if err := f(name, bp); err != nil {
+			for i, bp := range entry.earlyRequires {
+				unmet := name
+				if v := entry.earlyVersions[i]; v != "" {
+					unmet += "@" + v
+				}
+				if err := f(unmet, bp); err != nil {
 					return err
 				}
 			}
@@ -457,3 +649,42 @@ func (m depMap) eachUnmetRequire(f func(name string, bp Buildpack) error) error
 	}
 	return nil
 }
+
+func (e depEntry) satisfies(version string) bool {
+	required := []string{version}
+	for _, r := range e.Requires {
+		required = append(required, r.Version)
+	}
+	for _, provided := range e.versions {
+		if versionsIntersect(append(required, provided)...) {
+			return true
+		}
+	}
+	return false
+}
+
+// versionsIntersect reports whether a single version can satisfy every
+// constraint, where an empty constraint matches any version. Constraints that
+// are not valid semver ranges only match an identical constraint.
+func versionsIntersect(constraints ...string) bool {
+	var nonEmpty []string
+	for _, s := range constraints {
+		if s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	var combined semver.Constraint
+	for _, s := range nonEmpty {
+		c, err := semver.ParseConstraint(s)
+		if err != nil {
+			for _, other := range nonEmpty {
+				if other != s {
+					return false
+				}
+			}
+			return true
+		}
+		combined = combined.Intersect(c)
+	}
+	return !combined.Empty()
+}
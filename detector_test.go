@@ -1,20 +1,26 @@
 package lifecycle_test
 
 import (
+	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/memory"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
 	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
 )
 
 func TestDetector(t *testing.T) {
@@ -89,6 +95,54 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 			}
 		})
 
+		it("should fail with a cycle error if an order references itself", func() {
+			_, _, err := lifecycle.BuildpackOrder{
+				{Group: []lifecycle.Buildpack{{ID: "H", Version: "v1"}}},
+			}.Detect(config)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+
+			cycleErr, ok := err.(*lifecycle.ErrorCycle)
+			if !ok {
+				t.Fatalf("Unexpected error:\n%s\n", err)
+			}
+			if s := cmp.Diff(cycleErr.Cycle, []lifecycle.Buildpack{
+				{ID: "H", Version: "v1"},
+				{ID: "I", Version: "v1"},
+				{ID: "J", Version: "v1"},
+				{ID: "H", Version: "v1"},
+			}); s != "" {
+				t.Fatalf("Unexpected cycle:\n%s\n", s)
+			}
+			if s := err.Error(); s != "cyclic buildpack order: H@v1 -> I@v1 -> J@v1 -> H@v1" {
+				t.Fatalf("Unexpected error message:\n%s\n", s)
+			}
+		})
+
+		it("should not treat an order-containing buildpack in separate branches as a cycle", func() {
+			mkappfile("100", "detect-status-C-v1")
+
+			group, _, err := lifecycle.BuildpackOrder{
+				{Group: []lifecycle.Buildpack{
+					{ID: "F", Version: "v1"},
+					{ID: "G", Version: "v1"},
+				}},
+			}.Detect(config)
+			if err != nil {
+				t.Fatalf("Unexpected error:\n%s\n", err)
+			}
+
+			if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+				Group: []lifecycle.Buildpack{
+					{ID: "A", Version: "v2"},
+					{ID: "B", Version: "v2"},
+				},
+			}); s != "" {
+				t.Fatalf("Unexpected group:\n%s\n", s)
+			}
+		})
+
 		it("should select the first passing group", func() {
 			mkappfile("100", "detect-status")
 			mkappfile("0", "detect-status-A-v1", "detect-status-B-v1")
@@ -185,6 +239,621 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 			}
 		})
 
+		when("order extensions are provided", func() {
+			it("should run the pre and post buildpacks around every group", func() {
+				mkappfile("100", "detect-status-B-v1")
+				config.Extensions = lifecycle.OrderExtensions{
+					Pre:  []lifecycle.Buildpack{{ID: "A", Version: "v1"}},
+					Post: []lifecycle.Buildpack{{ID: "D", Version: "v1", Optional: true}},
+				}
+
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "B", Version: "v1"}}},
+					{Group: []lifecycle.Buildpack{{ID: "C", Version: "v1"}}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1"},
+						{ID: "C", Version: "v1"},
+						{ID: "D", Version: "v1"},
+					},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+			})
+
+			it("should fail every group if a required extension fails", func() {
+				mkappfile("100", "detect-status-D-v1")
+				config.Extensions = lifecycle.OrderExtensions{
+					Post: []lifecycle.Buildpack{{ID: "D", Version: "v1"}},
+				}
+
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "B", Version: "v1"}}},
+					{Group: []lifecycle.Buildpack{{ID: "C", Version: "v1"}}},
+				}.Detect(config)
+				if err != lifecycle.ErrFail {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+			})
+		})
+
+		when("a buildpack version is omitted or a range", func() {
+			it("should resolve the highest matching version present", func() {
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A"},
+						{ID: "B", Version: "^1"},
+						{ID: "C", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v2"},
+						{ID: "B", Version: "v1"},
+						{ID: "C", Version: "v1"},
+					},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+			})
+
+			it("should not resolve to a prerelease if the range does not name one", func() {
+				for _, version := range []string{"", "<3"} {
+					group, _, err := lifecycle.BuildpackOrder{
+						{Group: []lifecycle.Buildpack{{ID: "A", Version: version}}},
+					}.Detect(config)
+					if err != nil {
+						t.Fatalf("Unexpected error:\n%s\n", err)
+					}
+					if s := cmp.Diff(group.Group[0], lifecycle.Buildpack{ID: "A", Version: "v2"}); s != "" {
+						t.Fatalf("Unexpected buildpack for '%s':\n%s\n", version, s)
+					}
+				}
+			})
+
+			it("should resolve to a prerelease if the range names one", func() {
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "A", Version: ">=3.0.0-rc.1"}}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(group.Group[0], lifecycle.Buildpack{ID: "A", Version: "v3.0.0-rc.1"}); s != "" {
+					t.Fatalf("Unexpected buildpack:\n%s\n", s)
+				}
+			})
+
+			it("should fail if no version matches the range", func() {
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "A", Version: ">=3"}}},
+				}.Detect(config)
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				if s := err.Error(); s != "no version of buildpack A matches '>=3'" {
+					t.Fatalf("Unexpected error:\n%s\n", s)
+				}
+			})
+		})
+
+		when("the lifecycle's Buildpack API is provided", func() {
+			it.Before(func() {
+				config.BuildpackAPI = api.MustParse("0.2")
+			})
+
+			it("should fail if a buildpack declares an incompatible Buildpack API", func() {
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "L", Version: "v1"},
+						{ID: "K", Version: "v1"},
+					}},
+				}.Detect(config)
+				if _, ok := err.(*lifecycle.ErrorIncompatibleAPI); !ok {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := err.Error(); s != "buildpack K@v1 declares Buildpack API version 0.3 which is incompatible with the lifecycle's Buildpack API version 0.2" {
+					t.Fatalf("Unexpected error message:\n%s\n", s)
+				}
+			})
+
+			it("should skip optional buildpacks that declare an incompatible Buildpack API", func() {
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "K", Version: "v1", Optional: true},
+						{ID: "A", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{{ID: "A", Version: "v1"}},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+				if _, err := os.Stat(filepath.Join(config.AppDir, "detect-env-type-K-v1")); !os.IsNotExist(err) {
+					t.Fatalf("Expected detect not to run:\n%v\n", err)
+				}
+			})
+
+			it("should try the next group if a required buildpack declares an incompatible Buildpack API", func() {
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "K", Version: "v1"},
+						{ID: "A", Version: "v1"},
+					}},
+					{Group: []lifecycle.Buildpack{
+						{ID: "B", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{{ID: "B", Version: "v1"}},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+			})
+
+			it("should provide the declared Buildpack API to each buildpack", func() {
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "L", Version: "v1"},
+						{ID: "A", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if v := rdappfile("detect-api-L-v1"); v != "0.2" {
+					t.Fatalf("Unexpected Buildpack API: %s\n", v)
+				}
+				if v := rdappfile("detect-api-A-v1"); v != "" {
+					t.Fatalf("Unexpected Buildpack API: %s\n", v)
+				}
+				if s := allLogs(logHandler); !strings.Contains(s, "Buildpack A@v1 does not declare a Buildpack API version\n") {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+		})
+
+		when("a stack is provided", func() {
+			it("should skip optional buildpacks that do not support the stack", func() {
+				config.StackID = "stack.c"
+
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "M", Version: "v1", Optional: true},
+						{ID: "A", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{{ID: "A", Version: "v1"}},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+
+				if s := allLogs(logHandler); !strings.Contains(s,
+					"======== Error: M@v1 ========\n"+
+						"buildpack M@v1 does not support stack 'stack.c'\n",
+				) || !strings.Contains(s, "skip: M@v1\n") {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+				if _, err := os.Stat(filepath.Join(config.AppDir, "detect-env-type-M-v1")); !os.IsNotExist(err) {
+					t.Fatal("Expected bin/detect not to run")
+				}
+			})
+
+			it("should fail required buildpacks with missing mixins", func() {
+				config.StackID = "stack.a"
+				config.Mixins = []string{"git"}
+
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "M", Version: "v1"}}},
+				}.Detect(config)
+				if err != lifecycle.ErrFail {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := allLogs(logHandler); !strings.Contains(s,
+					"======== Error: M@v1 ========\n"+
+						"buildpack M@v1 requires missing mixins for stack 'stack.a': curl\n",
+				) || !strings.Contains(s, "fail: M@v1\n") {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+
+			it("should detect buildpacks that support the stack", func() {
+				config.StackID = "stack.a"
+				config.Mixins = []string{"git", "curl"}
+
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "M", Version: "v1"}}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{{ID: "M", Version: "v1"}},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+			})
+		})
+
+		when("a timeout is configured", func() {
+			it.Before(func() {
+				config.Timeout = time.Second
+				mkappfile("10", "detect-sleep-A-v1")
+			})
+
+			it("should fail a required buildpack that times out", func() {
+				start := time.Now()
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1"},
+						{ID: "B", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != lifecycle.ErrFail {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if d := time.Since(start); d > 5*time.Second {
+					t.Fatalf("Detection was not interrupted: took %s", d)
+				}
+
+				if s := allLogs(logHandler); !strings.Contains(s,
+					"======== Error: A@v1 ========\n"+
+						"buildpack A@v1 timed out after 1s during detection\n",
+				) {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+				var warnings []string
+				for _, e := range logHandler.Entries {
+					if e.Level == log.WarnLevel {
+						warnings = append(warnings, e.Message)
+					}
+				}
+				if s := cmp.Diff(warnings, []string{"buildpack A@v1 timed out after 1s during detection"}); s != "" {
+					t.Fatalf("Unexpected warnings:\n%s\n", s)
+				}
+			})
+
+			it("should skip an optional buildpack that times out", func() {
+				group, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1", Optional: true},
+						{ID: "B", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{{ID: "B", Version: "v1"}},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+			})
+		})
+
+		when("concurrency is limited", func() {
+			it("should not run more buildpacks at once than allowed", func() {
+				config.Concurrency = 1
+				mkappfile("", "detect-events")
+				mkappfile("0.2", "detect-sleep-A-v1", "detect-sleep-B-v1", "detect-sleep-C-v1")
+
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1"},
+						{ID: "B", Version: "v1"},
+						{ID: "C", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				events := strings.Split(strings.TrimSpace(rdappfile("detect-events")), "\n")
+				if len(events) != 6 {
+					t.Fatalf("Unexpected events:\n%s\n", strings.Join(events, "\n"))
+				}
+				for i := 0; i < len(events); i += 2 {
+					start, end := events[i], events[i+1]
+					if !strings.HasPrefix(start, "start ") || end != "end "+strings.TrimPrefix(start, "start ") {
+						t.Fatalf("Unexpected events:\n%s\n", strings.Join(events, "\n"))
+					}
+				}
+			})
+		})
+
+		when("the context is cancelled", func() {
+			it("should stop detection", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				config.Context = ctx
+
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "A", Version: "v1"}}},
+					{Group: []lifecycle.Buildpack{{ID: "B", Version: "v1"}}},
+				}.Detect(config)
+				if err != context.Canceled {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+			})
+		})
+
+		when("a detect cache is provided", func() {
+			var (
+				order lifecycle.BuildpackOrder
+				fresh lifecycle.DetectConfig
+			)
+
+			it.Before(func() {
+				order = lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "E", Version: "v1"}}},
+				}
+				config.Cache = &lifecycle.DetectCacheMetadata{}
+				fresh = *config
+			})
+
+			// detectAgain removes the files written by the test buildpacks so
+			// that the app directory is unchanged, then detects with a new config.
+			detectAgain := func() (lifecycle.BuildpackGroup, lifecycle.BuildPlan, error) {
+				t.Helper()
+				outputs, err := filepath.Glob(filepath.Join(config.AppDir, "detect-*"))
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				for _, path := range outputs {
+					if err := os.Remove(path); err != nil {
+						t.Fatalf("Unexpected error:\n%s\n", err)
+					}
+				}
+				return order.Detect(&fresh)
+			}
+
+			it("should record the detection results", func() {
+				toappfile("\n[[provides]]\n name = \"dep1\"", "detect-plan-A-v1.toml")
+				toappfile("\n[[requires]]\n name = \"dep1\"", "detect-plan-B-v1.toml")
+
+				if _, _, err := order.Detect(config); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if !strings.HasPrefix(config.Cache.Key, "sha256:") {
+					t.Fatalf("Unexpected key: %s\n", config.Cache.Key)
+				}
+				var ran []string
+				for _, run := range config.Cache.Runs {
+					ran = append(ran, run.Buildpack.String())
+				}
+				if s := cmp.Diff(ran, []string{"A@v1", "B@v1", "C@v1"}); s != "" {
+					t.Fatalf("Unexpected runs:\n%s\n", s)
+				}
+				if s := cmp.Diff(config.Cache.Runs[0].Provides, []lifecycle.Provide{{Name: "dep1"}}); s != "" {
+					t.Fatalf("Unexpected provides:\n%s\n", s)
+				}
+			})
+
+			it("should not record runs that failed with an error", func() {
+				mkappfile("1", "detect-status-B-v1")
+				order = lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1"},
+						{ID: "B", Version: "v1", Optional: true},
+					}},
+				}
+
+				if _, _, err := order.Detect(config); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				var ran []string
+				for _, run := range config.Cache.Runs {
+					ran = append(ran, run.Buildpack.String())
+				}
+				if s := cmp.Diff(ran, []string{"A@v1"}); s != "" {
+					t.Fatalf("Unexpected runs:\n%s\n", s)
+				}
+			})
+
+			it("should reuse cached results when the inputs are unchanged", func() {
+				firstGroup, firstPlan, err := order.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				key := config.Cache.Key
+
+				group, plan, err := detectAgain()
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(group, firstGroup); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+				if s := cmp.Diff(plan, firstPlan); s != "" {
+					t.Fatalf("Unexpected plan:\n%s\n", s)
+				}
+				if config.Cache.Key != key {
+					t.Fatalf("Unexpected key: %s\n", config.Cache.Key)
+				}
+				if _, err := os.Stat(filepath.Join(config.AppDir, "detect-env-A-v1")); !os.IsNotExist(err) {
+					t.Fatal("Expected detection to be skipped")
+				}
+				if s := allLogs(logHandler); !strings.Contains(s, "Reusing cached detection results\n") {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+
+			it("should replay the report from the cached results", func() {
+				config.Report = &lifecycle.DetectReport{}
+				if _, _, err := order.Detect(config); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				fresh.Report = &lifecycle.DetectReport{}
+				if _, _, err := detectAgain(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if _, err := os.Stat(filepath.Join(config.AppDir, "detect-env-A-v1")); !os.IsNotExist(err) {
+					t.Fatal("Expected detection to be skipped")
+				}
+				if s := cmp.Diff(fresh.Report, config.Report,
+					cmpopts.IgnoreFields(lifecycle.DetectReportBuildpack{}, "Output", "Usage"),
+				); s != "" {
+					t.Fatalf("Unexpected report:\n%s\n", s)
+				}
+				if len(fresh.Report.Groups) == 0 || !fresh.Report.Groups[len(fresh.Report.Groups)-1].Pass {
+					t.Fatalf("Expected a passing group:\n%+v\n", fresh.Report)
+				}
+			})
+
+			it("should detect again when the app changes", func() {
+				if _, _, err := order.Detect(config); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				key := config.Cache.Key
+
+				mkappfile("changed", "source-file")
+				if _, _, err := detectAgain(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if config.Cache.Key == key {
+					t.Fatal("Expected key to change")
+				}
+				if _, err := os.Stat(filepath.Join(config.AppDir, "detect-env-A-v1")); err != nil {
+					t.Fatalf("Expected detection to run:\n%s\n", err)
+				}
+			})
+
+			it("should detect again when forced", func() {
+				if _, _, err := order.Detect(config); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				fresh.ForceDetect = true
+				if _, _, err := detectAgain(); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if _, err := os.Stat(filepath.Join(config.AppDir, "detect-env-A-v1")); err != nil {
+					t.Fatalf("Expected detection to run:\n%s\n", err)
+				}
+			})
+		})
+
+		when("a report is requested", func() {
+			it("should record each group, buildpack and trial", func() {
+				mkappfile("100", "detect-status-A-v1")
+				toappfile("\n[[provides]]\n name = \"dep-missing\"", "detect-plan-C-v1.toml")
+				config.Report = &lifecycle.DetectReport{}
+
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "A", Version: "v1"}}},
+					{Group: []lifecycle.Buildpack{
+						{ID: "C", Version: "v1", Optional: true},
+						{ID: "B", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(config.Report, &lifecycle.DetectReport{
+					Groups: []lifecycle.DetectReportGroup{
+						{
+							Buildpacks: []lifecycle.DetectReportBuildpack{
+								{
+									Buildpack: lifecycle.Buildpack{ID: "A", Version: "v1"},
+									Result:    "fail",
+									Code:      100,
+									Output:    "detect out: A@v1\ndetect err: A@v1",
+								},
+							},
+						},
+						{
+							Buildpacks: []lifecycle.DetectReportBuildpack{
+								{
+									Buildpack: lifecycle.Buildpack{ID: "C", Version: "v1", Optional: true},
+									Result:    "pass",
+									Output:    "detect out: C@v1\ndetect err: C@v1",
+								},
+								{
+									Buildpack: lifecycle.Buildpack{ID: "B", Version: "v1"},
+									Result:    "pass",
+									Output:    "detect out: B@v1\ndetect err: B@v1",
+								},
+							},
+							Trials: []lifecycle.DetectReportTrial{
+								{
+									Options: []lifecycle.DetectReportOption{
+										{
+											Buildpack: lifecycle.Buildpack{ID: "C", Version: "v1", Optional: true},
+											Provides:  []lifecycle.Provide{{Name: "dep-missing"}},
+										},
+										{
+											Buildpack: lifecycle.Buildpack{ID: "B", Version: "v1"},
+										},
+									},
+									Eliminated: []lifecycle.DetectReportElimination{
+										{
+											Buildpack: lifecycle.Buildpack{ID: "C", Version: "v1", Optional: true},
+											Reason:    "provides unused",
+											Name:      "dep-missing",
+										},
+									},
+									Pass: true,
+								},
+							},
+							Pass: true,
+						},
+					},
+				}, cmpopts.IgnoreFields(lifecycle.DetectReportBuildpack{}, "Usage")); s != "" {
+					t.Fatalf("Unexpected report:\n%s\n", s)
+				}
+				for _, bp := range config.Report.Groups[1].Buildpacks {
+					if bp.Usage == nil || bp.Usage.WallTime <= 0 {
+						t.Fatalf("Unexpected usage for %s:\n%+v\n", bp.Buildpack, bp.Usage)
+					}
+				}
+			})
+		})
+
+		when("resource usage logging is enabled", func() {
+			it("should log the resources used by each buildpack", func() {
+				config.LogUsage = true
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{{ID: "A", Version: "v1"}, {ID: "B", Version: "v1"}}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				re := regexp.MustCompile(`======== Detect resource usage ========\n` +
+					`(A|B)@v1  wall \S+s  user \S+s  sys \S+s  max-rss \S+ MiB\n` +
+					`(A|B)@v1  wall \S+s  user \S+s  sys \S+s  max-rss \S+ MiB\n$`)
+				if s := allLogs(logHandler); !re.MatchString(s) {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+		})
+
 		when("a build plan is employed", func() {
 			it("should return a build plan with matched dependencies", func() {
 				mkappfile("100", "detect-status-C-v1")
@@ -362,6 +1031,192 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 				}
 			})
 
+			it("should record the resolved plan graph", func() {
+				toappfile("\n[[requires]]\n name = \"dep-missing\"", "detect-plan-A-v1.toml")
+				toappfile("\n[[provides]]\n name = \"dep1\"", "detect-plan-B-v1.toml")
+				toappfile("\n[[provides]]\n name = \"dep2\"", "detect-plan-B-v1.toml")
+				toappfile("\n[[requires]]\n name = \"dep1\"\n version = \"1.2\"", "detect-plan-C-v1.toml")
+				toappfile("\n[[requires]]\n name = \"dep1\"", "detect-plan-D-v1.toml")
+				toappfile("\n[[requires]]\n name = \"dep2\"", "detect-plan-D-v1.toml")
+				config.PlanGraph = &lifecycle.PlanGraph{}
+
+				_, _, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1", Optional: true},
+						{ID: "B", Version: "v1"},
+						{ID: "C", Version: "v1"},
+						{ID: "D", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(config.PlanGraph, &lifecycle.PlanGraph{
+					Nodes: []lifecycle.PlanGraphNode{
+						{
+							Buildpack:  lifecycle.Buildpack{ID: "A", Version: "v1", Optional: true},
+							Eliminated: true,
+							Reason:     "requires",
+							Name:       "dep-missing",
+						},
+						{Buildpack: lifecycle.Buildpack{ID: "B", Version: "v1"}},
+						{Buildpack: lifecycle.Buildpack{ID: "C", Version: "v1"}},
+						{Buildpack: lifecycle.Buildpack{ID: "D", Version: "v1"}},
+					},
+					Edges: []lifecycle.PlanGraphEdge{
+						{
+							Name:     "dep1",
+							Version:  "1.2",
+							Provider: lifecycle.Buildpack{ID: "B", Version: "v1"},
+							Requirer: lifecycle.Buildpack{ID: "C", Version: "v1"},
+						},
+						{
+							Name:     "dep1",
+							Provider: lifecycle.Buildpack{ID: "B", Version: "v1"},
+							Requirer: lifecycle.Buildpack{ID: "D", Version: "v1"},
+						},
+						{
+							Name:     "dep2",
+							Provider: lifecycle.Buildpack{ID: "B", Version: "v1"},
+							Requirer: lifecycle.Buildpack{ID: "D", Version: "v1"},
+						},
+					},
+				}); s != "" {
+					t.Fatalf("Unexpected graph:\n%s\n", s)
+				}
+
+				buf := &bytes.Buffer{}
+				if err := config.PlanGraph.WriteDOT(buf); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(buf.String(), "digraph plan {\n"+
+					"  \"A@v1\" [style=dashed, label=\"A@v1\\nrequires dep-missing\"];\n"+
+					"  \"B@v1\";\n"+
+					"  \"C@v1\";\n"+
+					"  \"D@v1\";\n"+
+					"  \"B@v1\" -> \"C@v1\" [label=\"dep1@1.2\"];\n"+
+					"  \"B@v1\" -> \"D@v1\" [label=\"dep1\"];\n"+
+					"  \"B@v1\" -> \"D@v1\" [label=\"dep2\"];\n"+
+					"}\n",
+				); s != "" {
+					t.Fatalf("Unexpected DOT output:\n%s\n", s)
+				}
+			})
+
+			it("should escape only quotes and backslashes in DOT labels", func() {
+				graph := &lifecycle.PlanGraph{
+					Nodes: []lifecycle.PlanGraphNode{
+						{
+							Buildpack:  lifecycle.Buildpack{ID: "A", Version: "v1"},
+							Eliminated: true,
+							Reason:     "requires",
+							Name:       `dep"\été`,
+						},
+						{Buildpack: lifecycle.Buildpack{ID: "B", Version: "v1"}},
+					},
+					Edges: []lifecycle.PlanGraphEdge{{
+						Name:     `dep"\été`,
+						Provider: lifecycle.Buildpack{ID: "B", Version: "v1"},
+						Requirer: lifecycle.Buildpack{ID: "B", Version: "v1"},
+					}},
+				}
+
+				buf := &bytes.Buffer{}
+				if err := graph.WriteDOT(buf); err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+				if s := cmp.Diff(buf.String(), "digraph plan {\n"+
+					`  "A@v1" [style=dashed, label="A@v1\nrequires dep\"\\été"];`+"\n"+
+					`  "B@v1";`+"\n"+
+					`  "B@v1" -> "B@v1" [label="dep\"\\été"];`+"\n"+
+					"}\n",
+				); s != "" {
+					t.Fatalf("Unexpected DOT output:\n%s\n", s)
+				}
+			})
+
+			it("should treat conflicting version requirements as unmet", func() {
+				toappfile("\n[[provides]]\n name = \"dep1\"", "detect-plan-A-v1.toml")
+				toappfile("\n[[requires]]\n name = \"dep1\"\n version = \"12\"", "detect-plan-B-v1.toml")
+				toappfile("\n[[requires]]\n name = \"dep1\"\n version = \"14\"", "detect-plan-C-v1.toml")
+
+				group, plan, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1"},
+						{ID: "B", Version: "v1"},
+						{ID: "C", Version: "v1", Optional: true},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if s := cmp.Diff(group, lifecycle.BuildpackGroup{
+					Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1"},
+						{ID: "B", Version: "v1"},
+					},
+				}); s != "" {
+					t.Fatalf("Unexpected group:\n%s\n", s)
+				}
+
+				if !hasEntries(plan.Entries, []lifecycle.BuildPlanEntry{
+					{
+						Providers: []lifecycle.Buildpack{{ID: "A", Version: "v1"}},
+						Requires:  []lifecycle.Require{{Name: "dep1", Version: "12"}},
+					},
+				}) {
+					t.Fatalf("Unexpected entries:\n%+v\n", plan.Entries)
+				}
+
+				if s := allLogs(logHandler); !strings.HasSuffix(s,
+					"Resolving plan... (try #1)\n"+
+						"skip: C@v1 requires dep1@14\n"+
+						"2 of 3 buildpacks participating\n"+
+						"A v1\n"+
+						"B v1\n",
+				) {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+
+			it("should fallback to alternate build plans when a provided version is unsatisfiable", func() {
+				toappfile("\n[[provides]]\n name = \"dep1\"\n version = \"12.x\"", "detect-plan-A-v1.toml")
+				toappfile("\n[[or]]", "detect-plan-A-v1.toml")
+				toappfile("\n[[or.provides]]\n name = \"dep1\"\n version = \"14.x\"", "detect-plan-A-v1.toml")
+				toappfile("\n[[requires]]\n name = \"dep1\"\n version = \">=14\"", "detect-plan-B-v1.toml")
+
+				_, plan, err := lifecycle.BuildpackOrder{
+					{Group: []lifecycle.Buildpack{
+						{ID: "A", Version: "v1"},
+						{ID: "B", Version: "v1"},
+					}},
+				}.Detect(config)
+				if err != nil {
+					t.Fatalf("Unexpected error:\n%s\n", err)
+				}
+
+				if !hasEntries(plan.Entries, []lifecycle.BuildPlanEntry{
+					{
+						Providers: []lifecycle.Buildpack{{ID: "A", Version: "v1"}},
+						Requires:  []lifecycle.Require{{Name: "dep1", Version: ">=14"}},
+					},
+				}) {
+					t.Fatalf("Unexpected entries:\n%+v\n", plan.Entries)
+				}
+
+				if s := allLogs(logHandler); !strings.HasSuffix(s,
+					"Resolving plan... (try #1)\n"+
+						"fail: B@v1 requires dep1@>=14\n"+
+						"Resolving plan... (try #2)\n"+
+						"A v1\n"+
+						"B v1\n",
+				) {
+					t.Fatalf("Unexpected log:\n%s\n", s)
+				}
+			})
+
 			it("should fallback to alternate build plans", func() {
 				toappfile("\n[[provides]]\n name = \"dep2-missing\"", "detect-plan-A-v1.toml")
 				toappfile("\n[[or]]", "detect-plan-A-v1.toml")
@@ -4,12 +4,15 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
 type Env struct {
 	RootDirMap map[string][]string
 	Vars       map[string]string
+	Expand     bool // if set, $VAR and ${VAR} references in layer env files are expanded
+	history    map[string][]Provenance
 }
 
 func varsFromEnviron(environ []string, removeKey func(string) bool) map[string]string {
@@ -41,55 +44,96 @@ func (p *Env) AddRootDir(baseDir string) error {
 		}
 		for _, key := range vars {
 			p.Vars[key] = newDir + prefix(p.Vars[key], os.PathListSeparator)
+			p.record(key, absBaseDir, "prepend", os.PathListSeparator)
 		}
 	}
 	return nil
 }
 
 func (p *Env) AddEnvDir(envDir string) error {
+	if p.Expand {
+		return p.addExpandedEnvDir(envDir)
+	}
 	return eachEnvFile(envDir, func(k, v string) error {
-		parts := strings.SplitN(k, ".", 2)
-		name := parts[0]
-		var action string
-		if len(parts) > 1 {
-			action = parts[1]
-		}
-		switch action {
-		case "prepend":
-			p.Vars[name] = v + prefix(p.Vars[name], delim(envDir, name)...)
-		case "append":
-			p.Vars[name] = suffix(p.Vars[name], delim(envDir, name)...) + v
-		case "override":
-			p.Vars[name] = v
-		case "default":
-			if p.Vars[name] != "" {
-				return nil
-			}
-			p.Vars[name] = v
-		case "":
-			p.Vars[name] = v + prefix(p.Vars[name], delim(envDir, name, os.PathListSeparator)...)
-		}
-		return nil
+		return p.addEnvFile(envDir, k, v)
 	})
 }
 
+func (p *Env) addEnvFile(envDir, file, v string) error {
+	name, action := splitEnvFile(file)
+	switch action {
+	case "prepend":
+		d := delim(envDir, name)
+		p.Vars[name] = v + prefix(p.Vars[name], d...)
+		p.record(name, envDir, action, d...)
+	case "append":
+		d := delim(envDir, name)
+		p.Vars[name] = suffix(p.Vars[name], d...) + v
+		p.record(name, envDir, action, d...)
+	case "override":
+		p.Vars[name] = v
+		p.record(name, envDir, action)
+	case "default":
+		if p.Vars[name] != "" {
+			return nil
+		}
+		p.Vars[name] = v
+		p.record(name, envDir, action)
+	case "":
+		d := delim(envDir, name, os.PathListSeparator)
+		p.Vars[name] = v + prefix(p.Vars[name], d...)
+		p.record(name, envDir, "prepend", d...)
+	}
+	return nil
+}
+
+func splitEnvFile(file string) (name, action string) {
+	parts := strings.SplitN(file, ".", 2)
+	if len(parts) > 1 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
 func (p *Env) WithPlatform(platformDir string) (out []string, err error) {
-	vars := make(map[string]string)
-	for key, value := range p.Vars {
-		vars[key] = value
+	penv, err := p.withPlatform(platformDir)
+	if err != nil {
+		return nil, err
 	}
+	return list(penv.Vars), nil
+}
 
-	if err := eachEnvFile(filepath.Join(platformDir, "env"), func(k, v string) error {
+// withPlatform returns a copy of the env with the platform env vars applied.
+func (p *Env) withPlatform(platformDir string) (*Env, error) {
+	penv := p.copy()
+	envDir := filepath.Join(platformDir, "env")
+	if err := eachEnvFile(envDir, func(k, v string) error {
 		if p.isRootEnv(k) {
-			vars[k] = v + prefix(vars[k], os.PathListSeparator)
+			penv.Vars[k] = v + prefix(penv.Vars[k], os.PathListSeparator)
+			penv.record(k, envDir, "prepend", os.PathListSeparator)
 			return nil
 		}
-		vars[k] = v
+		penv.Vars[k] = v
+		penv.record(k, envDir, "override")
 		return nil
 	}); err != nil {
 		return nil, err
 	}
-	return list(vars), nil
+	return penv, nil
+}
+
+func (p *Env) copy() *Env {
+	out := &Env{RootDirMap: p.RootDirMap, Vars: make(map[string]string), Expand: p.Expand}
+	for key, value := range p.Vars {
+		out.Vars[key] = value
+	}
+	if p.history != nil {
+		out.history = make(map[string][]Provenance)
+		for key, value := range p.history {
+			out.history[key] = append([]Provenance{}, value...)
+		}
+	}
+	return out
 }
 
 func (p *Env) List() []string {
@@ -101,10 +145,23 @@ func (p *Env) Get(k string) string {
 	return p.Vars[k]
 }
 
+// SetExecD sets the value for the given key as output by the exec.d
+// executable at path
+func (p *Env) SetExecD(k, v, path string) {
+	p.Vars[k] = v
+	p.record(k, path, "exec.d")
+}
+
+// list returns the vars sorted by name.
 func list(vars map[string]string) []string {
+	var keys []string
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 	var environ []string
-	for k, v := range vars {
-		environ = append(environ, k+"="+v)
+	for _, k := range keys {
+		environ = append(environ, k+"="+vars[k])
 	}
 	return environ
 }
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -151,6 +152,66 @@ func testEnv(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#AddEnvDir with expansion", func() {
+		it.Before(func() {
+			envv.Expand = true
+		})
+
+		it("should expand references to the env accumulated so far", func() {
+			mkfile(t, "${JAVA_HOME}/bin:$PATH", filepath.Join(tmpDir, "PATH.override"))
+			mkfile(t, "/opt/${JDK}", filepath.Join(tmpDir, "JAVA_HOME.override"))
+			mkfile(t, "jdk-11", filepath.Join(tmpDir, "JDK.override"))
+			mkfile(t, "cost $$5", filepath.Join(tmpDir, "VAR_ESCAPE.override"))
+			mkfile(t, "value-${VAR_MISSING}", filepath.Join(tmpDir, "VAR_MISSING_REF.override"))
+			envv.Vars = map[string]string{"PATH": "path-orig"}
+			if err := envv.AddEnvDir(tmpDir); err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+			if s := cmp.Diff(envv.List(), []string{
+				"JAVA_HOME=/opt/jdk-11",
+				"JDK=jdk-11",
+				"PATH=/opt/jdk-11/bin:path-orig",
+				"VAR_ESCAPE=cost $5",
+				"VAR_MISSING_REF=value-",
+			}); s != "" {
+				t.Fatalf("Unexpected env:\n%s\n", s)
+			}
+		})
+
+		it("should fail if env files reference each other", func() {
+			mkfile(t, "${VAR_B}", filepath.Join(tmpDir, "VAR_A.override"))
+			mkfile(t, "${VAR_C}", filepath.Join(tmpDir, "VAR_B.override"))
+			mkfile(t, "${VAR_A}", filepath.Join(tmpDir, "VAR_C.override"))
+			err := envv.AddEnvDir(tmpDir)
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if s := err.Error(); s != "cyclic reference in env files in "+tmpDir+": VAR_A -> VAR_B -> VAR_C -> VAR_A" {
+				t.Fatalf("Unexpected error:\n%s\n", s)
+			}
+		})
+
+		it("should not expand values unless enabled", func() {
+			envv.Expand = false
+			mkfile(t, "${VAR}", filepath.Join(tmpDir, "VAR_REF.override"))
+			if err := envv.AddEnvDir(tmpDir); err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+			if s := envv.Get("VAR_REF"); s != "${VAR}" {
+				t.Fatalf("Unexpected value: %s\n", s)
+			}
+		})
+	})
+
+	when("#List", func() {
+		it("should sort the env by name", func() {
+			envv.Vars = map[string]string{"VAR_C": "c", "VAR_A": "a", "VAR_B": "b"}
+			if s := cmp.Diff(envv.List(), []string{"VAR_A=a", "VAR_B=b", "VAR_C=c"}); s != "" {
+				t.Fatalf("Unexpected env:\n%s\n", s)
+			}
+		})
+	})
+
 	when("#WithPlatform", func() {
 		it("should apply platform env vars as filename=file-contents", func() {
 			mkdir(t, filepath.Join(tmpDir, "env", "some-dir"))
@@ -184,6 +245,86 @@ func testEnv(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#DescribeProvenance", func() {
+		it("should describe the source of each change", func() {
+			mkdir(t,
+				filepath.Join(tmpDir, "layer", "bin"),
+				filepath.Join(tmpDir, "layer", "env"),
+				filepath.Join(tmpDir, "platform", "env"),
+			)
+			mkfile(t, "value-append", filepath.Join(tmpDir, "layer", "env", "VAR.append"))
+			mkfile(t, "|", filepath.Join(tmpDir, "layer", "env", "VAR.delim"))
+			mkfile(t, "value-default", filepath.Join(tmpDir, "layer", "env", "VAR_DEFAULT.default"))
+			mkfile(t, "value-platform", filepath.Join(tmpDir, "platform", "env", "PATH"))
+			envv.Vars = map[string]string{
+				"PATH":        "path-orig",
+				"VAR":         "value-orig",
+				"VAR_DEFAULT": "value-orig",
+				"VAR_OTHER":   "value-orig",
+			}
+			envv.RecordProvenance()
+			if err := envv.AddRootDir(filepath.Join(tmpDir, "layer")); err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+			if err := envv.AddEnvDir(filepath.Join(tmpDir, "layer", "env")); err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+
+			out, err := envv.DescribeProvenance(filepath.Join(tmpDir, "platform"), func(source string) string {
+				return strings.TrimPrefix(source, tmpDir+"/")
+			})
+			if err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+			if s := cmp.Diff(out, []string{
+				fmt.Sprintf("PATH=value-platform:%s/layer/bin:path-orig (from layer prepend, platform prepend)", tmpDir),
+				"VAR=value-orig|value-append (from layer/env append)",
+			}); s != "" {
+				t.Fatalf("Unexpected description:\n%s\n", s)
+			}
+			if s := cmp.Diff(envv.Provenance("VAR"), []env.Provenance{
+				{Source: filepath.Join(tmpDir, "layer", "env"), Action: "append", Delim: "|"},
+			}); s != "" {
+				t.Fatalf("Unexpected provenance:\n%s\n", s)
+			}
+			if s := envv.Get("PATH"); s != filepath.Join(tmpDir, "layer", "bin")+":path-orig" {
+				t.Fatalf("Unexpected PATH: %s\n", s)
+			}
+		})
+
+		it("should describe env vars set by exec.d executables", func() {
+			envv.Vars = map[string]string{}
+			envv.RecordProvenance()
+			envv.SetExecD("VAR", "value-exec", filepath.Join(tmpDir, "layer", "exec.d", "some-exec"))
+
+			out, err := envv.DescribeProvenance("", func(source string) string {
+				return strings.TrimPrefix(source, tmpDir+"/")
+			})
+			if err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+			if s := cmp.Diff(out, []string{
+				"VAR=value-exec (from layer/exec.d/some-exec exec.d)",
+			}); s != "" {
+				t.Fatalf("Unexpected description:\n%s\n", s)
+			}
+		})
+
+		it("should not record changes unless enabled", func() {
+			mkdir(t, filepath.Join(tmpDir, "bin"))
+			if err := envv.AddRootDir(tmpDir); err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+			out, err := envv.DescribeProvenance("", nil)
+			if err != nil {
+				t.Fatalf("Error: %s\n", err)
+			}
+			if len(out) != 0 {
+				t.Fatalf("Unexpected description:\n%s\n", out)
+			}
+		})
+	})
+
 	when("#Get", func() {
 		it("should get a value", func() {
 			mkdir(t,
@@ -0,0 +1,75 @@
+package env
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type envFile struct {
+	file    string
+	value   string
+	applied bool
+}
+
+// addExpandedEnvDir is AddEnvDir with $VAR and ${VAR} references in each value
+// expanded against the env accumulated so far. A reference to a variable that
+// is set by another file in the same directory is expanded after that file is
+// applied, regardless of the order of the files. A variable's reference to
+// itself expands to its previous value, and $$ expands to $.
+func (p *Env) addExpandedEnvDir(envDir string) error {
+	var files []*envFile
+	byName := map[string][]*envFile{}
+	if err := eachEnvFile(envDir, func(k, v string) error {
+		f := &envFile{file: k, value: v}
+		files = append(files, f)
+		name, _ := splitEnvFile(k)
+		byName[name] = append(byName[name], f)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var apply func(f *envFile, stack []string) error
+	apply = func(f *envFile, stack []string) error {
+		if f.applied {
+			return nil
+		}
+		name, action := splitEnvFile(f.file)
+		for i, s := range stack {
+			if s == name {
+				return errors.Errorf("cyclic reference in env files in %s: %s", envDir, strings.Join(append(stack[i:], name), " -> "))
+			}
+		}
+		value := f.value
+		if action != "delim" {
+			var err error
+			value = os.Expand(f.value, func(ref string) string {
+				if ref == "$" {
+					return "$"
+				}
+				if ref != name {
+					for _, dep := range byName[ref] {
+						if err == nil {
+							err = apply(dep, append(stack, name))
+						}
+					}
+				}
+				return p.Vars[ref]
+			})
+			if err != nil {
+				return err
+			}
+		}
+		f.applied = true
+		return p.addEnvFile(envDir, f.file, value)
+	}
+
+	for _, f := range files {
+		if err := apply(f, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
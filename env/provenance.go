@@ -0,0 +1,71 @@
+package env
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Provenance records a change made to an environment variable.
+type Provenance struct {
+	Source string // the layer, layer env directory or platform env directory
+	Action string // prepend, append, override, default or exec.d
+	Delim  string
+}
+
+// RecordProvenance makes the env record every later change to its variables,
+// so that they can be described by DescribeProvenance.
+func (p *Env) RecordProvenance() {
+	if p.history == nil {
+		p.history = make(map[string][]Provenance)
+	}
+}
+
+// Provenance returns the recorded changes to the named variable, oldest first.
+func (p *Env) Provenance(name string) []Provenance {
+	return p.history[name]
+}
+
+func (p *Env) record(name, source, action string, delim ...byte) {
+	if p.history == nil {
+		return
+	}
+	p.history[name] = append(p.history[name], Provenance{Source: source, Action: action, Delim: string(delim)})
+}
+
+// DescribeProvenance returns a line for each recorded variable, such as
+// "PATH=/layers/a/bin:/usr/bin (from /layers/a prepend, platform override)".
+// If platformDir is not empty, the platform env vars are applied first. If
+// label is not nil, it is used to shorten the source of each change.
+func (p *Env) DescribeProvenance(platformDir string, label func(source string) string) ([]string, error) {
+	penv := p
+	if platformDir != "" {
+		var err error
+		if penv, err = p.withPlatform(platformDir); err != nil {
+			return nil, err
+		}
+	}
+	var names []string
+	for name := range penv.history {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []string
+	for _, name := range names {
+		var sources []string
+		for _, h := range penv.history[name] {
+			source := h.Source
+			switch {
+			case platformDir != "" && source == filepath.Join(platformDir, "env"):
+				source = "platform"
+			case label != nil:
+				source = label(source)
+			}
+			sources = append(sources, source+" "+h.Action)
+		}
+		out = append(out, fmt.Sprintf("%s=%s (from %s)", name, penv.Vars[name], strings.Join(sources, ", ")))
+	}
+	return out, nil
+}
@@ -33,7 +33,8 @@ type Exporter struct {
 	ArtifactsDir string
 	Logger       Logger
 	UID, GID     int
-	tarHashes    map[string]string // Stores hashes of layer tarballs for reuse between the export and cache steps.
+	DetectCache  *DetectCacheMetadata // if nil, cached detection results from the previous build are kept
+	tarHashes    map[string]string    // Stores hashes of layer tarballs for reuse between the export and cache steps.
 }
 
 type LauncherConfig struct {
@@ -234,7 +235,10 @@ func (e *Exporter) Cache(layersDir string, cacheStore Cache) error {
 	if err != nil {
 		return errors.Wrap(err, "metadata for previous cache")
 	}
-	meta := CacheMetadata{}
+	meta := CacheMetadata{Detect: origMeta.Detect}
+	if e.DetectCache != nil {
+		meta.Detect = e.DetectCache
+	}
 
 	for _, bp := range e.Buildpacks {
 		bpDir, err := readBuildpackLayersDir(layersDir, bp)
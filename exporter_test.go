@@ -1288,13 +1288,34 @@ type = "Apache-2.0"
 						previousCache, err := cache.NewVolumeCache(cacheDir)
 						h.AssertNil(t, err)
 
+						exporter.DetectCache = &lifecycle.DetectCacheMetadata{Key: "previous-key"}
 						err = exporter.Cache(layersDir, previousCache)
 						h.AssertNil(t, err)
+						exporter.DetectCache = nil
 
 						testCache, err = cache.NewVolumeCache(cacheDir)
 						h.AssertNil(t, err)
 					})
 
+					it("keeps the previous detection results if none are provided", func() {
+						err := exporter.Cache(layersDir, testCache)
+						h.AssertNil(t, err)
+
+						metadata, err := testCache.RetrieveMetadata()
+						h.AssertNil(t, err)
+						h.AssertEq(t, metadata.Detect.Key, "previous-key")
+					})
+
+					it("replaces the previous detection results if provided", func() {
+						exporter.DetectCache = &lifecycle.DetectCacheMetadata{Key: "new-key"}
+						err := exporter.Cache(layersDir, testCache)
+						h.AssertNil(t, err)
+
+						metadata, err := testCache.RetrieveMetadata()
+						h.AssertNil(t, err)
+						h.AssertEq(t, metadata.Detect.Key, "new-key")
+					})
+
 					it("reuses layers when the calculated sha matches previous metadata", func() {
 						previousLayers, err := filepath.Glob(filepath.Join(cacheDir, "committed", "*.tar"))
 						h.AssertNil(t, err)
@@ -0,0 +1,12 @@
+package procutil
+
+import (
+	"os"
+	"os/exec"
+)
+
+func SetProcessGroup(cmd *exec.Cmd) {}
+
+func KillProcessGroup(proc *os.Process) error {
+	return proc.Kill()
+}
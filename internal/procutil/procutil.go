@@ -0,0 +1,25 @@
+// Package procutil provides helpers shared by the lifecycle and the launcher
+// for running child processes.
+package procutil
+
+import (
+	"io"
+	"sync"
+)
+
+// LockedWriter serializes writes, so that the output of several processes can
+// be copied to the same writer.
+type LockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLockedWriter(w io.Writer) *LockedWriter {
+	return &LockedWriter{w: w}
+}
+
+func (lw *LockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
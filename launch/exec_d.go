@@ -0,0 +1,83 @@
+package launch
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// Each exec.d executable may write TOML env vars to file descriptor 3, which
+// are set in the env of later executables and of the process.
+func (l *Launcher) execD(processType string) error {
+	return l.eachBuildpackDir(func(path string) error {
+		return eachDir(path, func(path string) error {
+			if err := l.execDDir(filepath.Join(path, "exec.d")); err != nil {
+				return err
+			}
+			if processType == "" {
+				return nil
+			}
+			return l.execDDir(filepath.Join(path, "exec.d", processType))
+		})
+	})
+}
+
+func (l *Launcher) execDDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || f.Mode()&0111 == 0 {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		vars, err := l.runExecD(path)
+		if err != nil {
+			return errors.Wrapf(err, "exec.d %s", path)
+		}
+		for k, v := range vars {
+			l.Env.SetExecD(k, v, path)
+		}
+	}
+	return nil
+}
+
+func (l *Launcher) runExecD(path string) (map[string]string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(path)
+	cmd.Dir = l.AppDir
+	cmd.Env = l.Env.List()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{w} // file descriptor 3
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+	out, readErr := ioutil.ReadAll(r)
+	if err := cmd.Wait(); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	vars := map[string]string{}
+	if _, err := toml.Decode(string(out), &vars); err != nil {
+		return nil, errors.Wrap(err, "parse output")
+	}
+	return vars, nil
+}
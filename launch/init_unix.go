@@ -0,0 +1,121 @@
+// +build linux darwin
+
+package launch
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// RunInit starts argv0 as a child process instead of replacing the launcher
+// with it, so that the launcher can act as an init process. It forwards every
+// catchable signal to the child, reaps any orphaned processes that are
+// re-parented to the launcher, and returns the exit status of the child once
+// it exits. A child killed by a signal has an exit status of 128 plus the
+// signal number.
+func RunInit(argv0 string, argv []string, envv []string) (int, error) {
+	sigs := make(chan os.Signal, 64)
+	signal.Notify(sigs)
+	defer signal.Stop(sigs)
+
+	attr := &syscall.ProcAttr{
+		Env:   envv,
+		Files: []uintptr{0, 1, 2},
+		Sys:   &syscall.SysProcAttr{Setpgid: true},
+	}
+	if isTerminal(0) {
+		attr.Sys.Foreground = true
+		attr.Sys.Ctty = 0
+	}
+	pid, err := syscall.ForkExec(argv0, argv, attr)
+	if err != nil {
+		return 0, errors.Wrap(err, "start process")
+	}
+
+	for {
+		var (
+			status int
+			exited bool
+		)
+		reap(func(wpid, ws int) {
+			if wpid == pid {
+				status, exited = ws, true
+			}
+		})
+		if exited {
+			return status, nil
+		}
+		sig, ok := (<-sigs).(syscall.Signal)
+		if !ok || sig == syscall.SIGCHLD || sig == syscall.SIGURG {
+			continue
+		}
+		// the child may exit before the signal is delivered
+		_ = syscall.Kill(pid, sig)
+	}
+}
+
+// startReaper also reaps any orphaned processes that are re-parented to the
+// launcher until it is stopped.
+func startReaper(pids map[int]string, exited func(processType string, status int)) (func(), error) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGCHLD)
+	done := make(chan struct{})
+	go func() {
+		for {
+			reap(func(pid, status int) {
+				if processType, ok := pids[pid]; ok {
+					exited(processType, status)
+				}
+			})
+			select {
+			case <-sigs:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}, nil
+}
+
+func reap(exited func(pid, status int)) {
+	for {
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || wpid <= 0 {
+			return
+		}
+		if ws.Exited() || ws.Signaled() {
+			exited(wpid, waitStatus(ws))
+		}
+	}
+}
+
+func exitStatus(state *os.ProcessState) int {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok {
+		return waitStatus(ws)
+	}
+	return state.ExitCode()
+}
+
+func waitStatus(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+func isTerminal(fd uintptr) bool {
+	var pgrp int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgrp)))
+	return errno == 0
+}
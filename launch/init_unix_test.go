@@ -0,0 +1,58 @@
+// +build linux darwin
+
+package launch_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/launch"
+)
+
+func TestRunInit(t *testing.T) {
+	spec.Run(t, "RunInit", testRunInit, spec.Report(report.Terminal{}))
+}
+
+func testRunInit(t *testing.T, when spec.G, it spec.S) {
+	when("#RunInit", func() {
+		it("should return the exit status of the process", func() {
+			status, err := launch.RunInit("/bin/sh", []string{"sh", "-c", "exit 3"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != 3 {
+				t.Fatalf("expected status 3, got %d", status)
+			}
+		})
+
+		it("should forward signals to the process", func() {
+			status, err := launch.RunInit("/bin/sh", []string{"sh", "-c",
+				`trap "exit 7" TERM; kill -TERM $PPID; while true; do sleep 0.1; done`,
+			}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != 7 {
+				t.Fatalf("expected status 7, got %d", status)
+			}
+		})
+
+		it("should report a signaled process as 128 plus the signal", func() {
+			status, err := launch.RunInit("/bin/sh", []string{"sh", "-c", "kill -KILL $$"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != 137 {
+				t.Fatalf("expected status 137, got %d", status)
+			}
+		})
+
+		it("should fail if the process cannot be started", func() {
+			if _, err := launch.RunInit("/does/not/exist", []string{"exist"}, nil); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	})
+}
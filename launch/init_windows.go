@@ -0,0 +1,20 @@
+package launch
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// RunInit is not supported on Windows, which has no init process.
+func RunInit(argv0 string, argv []string, envv []string) (int, error) {
+	return 0, errors.New("init mode is not supported on Windows")
+}
+
+func startReaper(pids map[int]string, exited func(processType string, status int)) (func(), error) {
+	return nil, errors.New("init mode is not supported on Windows")
+}
+
+func exitStatus(state *os.ProcessState) int {
+	return state.ExitCode()
+}
@@ -0,0 +1,79 @@
+package launch
+
+import "strings"
+
+func (l *Launcher) interpolateProcess(process Process) Process {
+	vars := map[string]string{}
+	for _, kv := range l.Env.List() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			vars[parts[0]] = parts[1]
+		}
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	process.Command = interpolate(process.Command, lookup)
+	args := make([]string, len(process.Args))
+	for i, arg := range process.Args {
+		args[i] = interpolate(arg, lookup)
+	}
+	process.Args = args
+	return process
+}
+
+// interpolate expands $(VAR) and ${VAR} references in s. A reference to an
+// unset var is left as is, and $$ escapes a $ before a reference, so that
+// $$(VAR) becomes the literal $(VAR). Any other $$ is left as is, so args
+// written before interpolation, like pa$$word, are passed unchanged.
+func interpolate(s string, lookup func(string) (string, bool)) string {
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			out.WriteByte(s[i])
+			continue
+		}
+		switch next := s[i+1]; next {
+		case '$':
+			if i+2 == len(s) || (s[i+2] != '(' && s[i+2] != '{') {
+				out.WriteByte('$')
+			}
+			out.WriteByte('$')
+			i++
+		case '(', '{':
+			closing := byte(')')
+			if next == '{' {
+				closing = '}'
+			}
+			end := strings.IndexByte(s[i+2:], closing)
+			if end < 0 {
+				out.WriteByte('$')
+				continue
+			}
+			name := s[i+2 : i+2+end]
+			if v, ok := lookup(name); ok && isVarName(name) {
+				out.WriteString(v)
+			} else {
+				out.WriteString(s[i : i+3+end])
+			}
+			i += 2 + end
+		default:
+			out.WriteByte('$')
+		}
+	}
+	return out.String()
+}
+
+func isVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package launch
 
 import (
 	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -26,6 +27,7 @@ type Env interface {
 	AddEnvDir(envDir string) error
 	List() []string
 	Get(string) string
+	SetExecD(name, value, path string)
 }
 
 func EscapeID(id string) string {
@@ -35,3 +37,24 @@ func EscapeID(id string) string {
 func GetMetadataFilePath(layersDir string) string {
 	return path.Join(layersDir, "config", "metadata.toml")
 }
+
+// LayerLabel returns a function that describes a path within a layer of one
+// of the buildpacks as <buildpack ID>:<layer name>. Other paths are returned
+// unchanged.
+func LayerLabel(layersDir string, bps []Buildpack) func(path string) string {
+	ids := map[string]string{}
+	for _, bp := range bps {
+		ids[EscapeID(bp.ID)] = bp.ID
+	}
+	return func(path string) string {
+		rel, err := filepath.Rel(layersDir, path)
+		if err != nil {
+			return path
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if id, ok := ids[parts[0]]; ok && len(parts) > 1 {
+			return id + ":" + parts[1]
+		}
+		return path
+	}
+}
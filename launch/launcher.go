@@ -7,6 +7,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -20,65 +21,85 @@ type Launcher struct {
 	Env                Env
 	Exec               func(argv0 string, argv []string, envv []string) error
 	Setenv             func(string, string) error
+	Bash               string        // defaults to /bin/bash
+	Sh                 string        // used if bash is missing, defaults to /bin/sh
+	StopTimeout        time.Duration // used by LaunchAll, defaults to 10 seconds
+	Init               bool          // used by LaunchAll to reap orphaned processes
 }
 
 func (l *Launcher) Launch(self string, cmd []string) error {
-	if err := l.env(); err != nil {
-		return errors.Wrap(err, "modify env")
-	}
 	process, err := l.processFor(cmd)
 	if err != nil {
 		return errors.Wrap(err, "determine start command")
 	}
+	if err := l.env(process.Type); err != nil {
+		return errors.Wrap(err, "modify env")
+	}
+	if err := l.execD(process.Type); err != nil {
+		return errors.Wrap(err, "run exec.d")
+	}
 	if err := os.Chdir(l.AppDir); err != nil {
 		return errors.Wrap(err, "change to app directory")
 	}
 	if process.Direct {
-		if err := l.Setenv("PATH", l.Env.Get("PATH")); err != nil {
-			return errors.Wrap(err, "set path")
-		}
-		binary, err := exec.LookPath(process.Command)
-		if err != nil {
-			return errors.Wrap(err, "path lookup")
-		}
-
-		if err := l.Exec(binary,
-			append([]string{process.Command}, process.Args...),
-			l.Env.List(),
-		); err != nil {
-			return errors.Wrap(err, "direct exec")
+		if process.Type != "" {
+			process = l.interpolateProcess(process)
 		}
-		return nil
+		return l.execDirect(process.Command, append([]string{process.Command}, process.Args...))
 	}
-	launcher, err := l.profileD()
+	scripts, err := l.profileScripts()
 	if err != nil {
 		return errors.Wrap(err, "determine profile")
 	}
-	if err := l.Exec("/bin/bash", append([]string{
-		"bash", "-c",
-		launcher, self, process.Command,
+	shell, err := l.shellFor(process, scripts)
+	if err != nil {
+		return err
+	}
+	if shell == "" {
+		argv, err := tokenize(process.Command, process.Args)
+		if err != nil {
+			return errors.Wrapf(err, "%s cannot run without a shell", describeProcess(process))
+		}
+		return l.execDirect(argv[0], argv)
+	}
+	name := filepath.Base(shell)
+	if err := l.Exec(shell, append([]string{
+		name, "-c",
+		profileD(name, scripts), self, process.Command,
 	}, process.Args...), l.Env.List()); err != nil {
-		return errors.Wrap(err, "bash exec")
+		return errors.Wrap(err, name+" exec")
 	}
 	return nil
 }
 
-func (l *Launcher) env() error {
-	appInfo, err := os.Stat(l.AppDir)
+// ProcessEnv returns the env that the process type would be launched with,
+// excluding any env vars set by exec.d executables, without launching it.
+func (l *Launcher) ProcessEnv(processType string) ([]string, error) {
+	if _, ok := l.findProcessType(processType); !ok {
+		return nil, fmt.Errorf("process type %s was not found", processType)
+	}
+	if err := l.env(processType); err != nil {
+		return nil, errors.Wrap(err, "modify env")
+	}
+	return l.Env.List(), nil
+}
+
+func (l *Launcher) execDirect(command string, argv []string) error {
+	if err := l.Setenv("PATH", l.Env.Get("PATH")); err != nil {
+		return errors.Wrap(err, "set path")
+	}
+	binary, err := exec.LookPath(command)
 	if err != nil {
-		return errors.Wrap(err, "find app directory")
+		return errors.Wrap(err, "path lookup")
 	}
-	return l.eachBuildpack(l.LayersDir, func(path string) error {
-		bpInfo, err := os.Stat(path)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return nil
-			}
-			return errors.Wrap(err, "find buildpack directory")
-		}
-		if os.SameFile(appInfo, bpInfo) {
-			return nil
-		}
+	if err := l.Exec(binary, argv, l.Env.List()); err != nil {
+		return errors.Wrap(err, "direct exec")
+	}
+	return nil
+}
+
+func (l *Launcher) env(processType string) error {
+	return l.eachBuildpackDir(func(path string) error {
 		if err := eachDir(path, func(path string) error {
 			return l.Env.AddRootDir(path)
 		}); err != nil {
@@ -88,7 +109,19 @@ func (l *Launcher) env() error {
 			if err := l.Env.AddEnvDir(filepath.Join(path, "env")); err != nil {
 				return err
 			}
-			return l.Env.AddEnvDir(filepath.Join(path, "env.launch"))
+			if err := l.Env.AddEnvDir(filepath.Join(path, "env.launch")); err != nil {
+				return err
+			}
+			if processType == "" {
+				return nil
+			}
+			processEnvDir := filepath.Join(path, "env.launch", processType)
+			if _, err := os.Stat(processEnvDir); os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			return l.Env.AddEnvDir(processEnvDir)
 		}); err != nil {
 			return errors.Wrap(err, "add layer env")
 		}
@@ -96,7 +129,7 @@ func (l *Launcher) env() error {
 	})
 }
 
-func (l *Launcher) profileD() (string, error) {
+func (l *Launcher) profileScripts() ([]string, error) {
 	var out []string
 
 	appendIfFile := func(path string) error {
@@ -108,32 +141,43 @@ func (l *Launcher) profileD() (string, error) {
 			return err
 		}
 		if !fi.IsDir() {
-			out = append(out, fmt.Sprintf(`source "%s"`, path))
+			out = append(out, path)
 		}
 		return nil
 	}
 	layersDir, err := filepath.Abs(l.LayersDir)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	for _, bp := range l.Buildpacks {
 		scripts, err := filepath.Glob(filepath.Join(layersDir, EscapeID(bp.ID), "*", "profile.d", "*"))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		for _, script := range scripts {
 			if err := appendIfFile(script); err != nil {
-				return "", err
+				return nil, err
 			}
 		}
 	}
 
 	if err := appendIfFile(filepath.Join(l.AppDir, ".profile")); err != nil {
-		return "", err
+		return nil, err
 	}
+	return out, nil
+}
 
-	out = append(out, `exec bash -c "$@"`)
-	return strings.Join(out, "\n"), nil
+func profileD(shell string, scripts []string) string {
+	source := "source"
+	if shell != "bash" {
+		source = "."
+	}
+	var out []string
+	for _, script := range scripts {
+		out = append(out, fmt.Sprintf(`%s "%s"`, source, script))
+	}
+	out = append(out, fmt.Sprintf(`exec %s -c "$@"`, shell))
+	return strings.Join(out, "\n")
 }
 
 func (l *Launcher) processFor(cmd []string) (Process, error) {
@@ -186,6 +230,26 @@ func eachDir(dir string, fn func(path string) error) error {
 	return nil
 }
 
+func (l *Launcher) eachBuildpackDir(fn func(path string) error) error {
+	appInfo, err := os.Stat(l.AppDir)
+	if err != nil {
+		return errors.Wrap(err, "find app directory")
+	}
+	return l.eachBuildpack(l.LayersDir, func(path string) error {
+		bpInfo, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return errors.Wrap(err, "find buildpack directory")
+		}
+		if os.SameFile(appInfo, bpInfo) {
+			return nil
+		}
+		return fn(path)
+	})
+}
+
 func (l *Launcher) eachBuildpack(dir string, fn func(path string) error) error {
 	for _, bp := range l.Buildpacks {
 		if err := fn(filepath.Join(l.LayersDir, EscapeID(bp.ID))); err != nil {
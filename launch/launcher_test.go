@@ -1,11 +1,14 @@
 package launch_test
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
@@ -42,7 +45,7 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 	it.Before(func() {
 		mockCtrl = gomock.NewController(t)
 		env = testmock.NewMockEnv(mockCtrl)
-		env.EXPECT().List().Return(envList).AnyTimes()
+		env.EXPECT().List().DoAndReturn(func() []string { return envList }).AnyTimes()
 
 		var err error
 		tmpDir, err = ioutil.TempDir("", "lifecycle.launcher.")
@@ -215,6 +218,54 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 				}
 			})
 
+			it("should expand env var references in a process type's command and args", func() {
+				launcher.Processes = []launch.Process{{
+					Type:    "direct",
+					Command: "${TEST_CMD}",
+					Args:    []string{"--one", "$(TEST_ENV_ONE)", "--two=${TEST_ENV_TWO}", "$$(TEST_ENV_ONE)", "$(MISSING)", "$HOME"},
+					Direct:  true,
+				}}
+				envList = append(envList, "TEST_CMD=sh")
+
+				if err := launcher.Launch("/path/to/launcher", []string{"direct"}); err != nil {
+					t.Fatal(err)
+				}
+
+				if len(syscallExecArgsColl) != 1 {
+					t.Fatalf("expected syscall.Exec to be called once: actual %v\n", syscallExecArgsColl)
+				}
+				if diff := cmp.Diff(syscallExecArgsColl[0].argv0, "/bin/sh"); diff != "" {
+					t.Fatalf("syscall.Exec Argv did not match: (-got +want)\n%s\n", diff)
+				}
+				if diff := cmp.Diff(syscallExecArgsColl[0].argv, []string{
+					"sh", "--one", "1", "--two=2", "$(TEST_ENV_ONE)", "$(MISSING)", "$HOME",
+				}); diff != "" {
+					t.Fatalf("syscall.Exec Argv did not match: (-got +want)\n%s\n", diff)
+				}
+			})
+
+			it("should only treat $$ as an escape before a reference", func() {
+				launcher.Processes = []launch.Process{{
+					Type:    "direct",
+					Command: "sh",
+					Args:    []string{"pa$$word", "$$", "$$$(TEST_ENV_ONE)", "$${TEST_ENV_ONE}"},
+					Direct:  true,
+				}}
+
+				if err := launcher.Launch("/path/to/launcher", []string{"direct"}); err != nil {
+					t.Fatal(err)
+				}
+
+				if len(syscallExecArgsColl) != 1 {
+					t.Fatalf("expected syscall.Exec to be called once: actual %v\n", syscallExecArgsColl)
+				}
+				if diff := cmp.Diff(syscallExecArgsColl[0].argv, []string{
+					"sh", "pa$$word", "$$", "$$1", "${TEST_ENV_ONE}",
+				}); diff != "" {
+					t.Fatalf("syscall.Exec Argv did not match: (-got +want)\n%s\n", diff)
+				}
+			})
+
 			it("should invoke a provided start command directly", func() {
 				if err := launcher.Launch("/path/to/launcher", []string{"--", "sh", "arg1", "arg2"}); err != nil {
 					t.Fatal(err)
@@ -246,6 +297,54 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("neither bash nor sh exists", func() {
+			var setPath string
+
+			it.Before(func() {
+				launcher.Bash = filepath.Join(tmpDir, "no-bash")
+				launcher.Sh = filepath.Join(tmpDir, "no-sh")
+				launcher.Processes = []launch.Process{
+					{Type: "web", Command: `sh -c 'echo "$1"' $0`, Args: []string{"some arg"}},
+				}
+				launcher.Setenv = func(k string, v string) error {
+					if k == "PATH" {
+						setPath = v
+					}
+					return nil
+				}
+			})
+
+			it("should tokenize the start command and invoke it directly", func() {
+				env.EXPECT().Get("PATH").Return("some-path")
+
+				if err := launcher.Launch("/path/to/launcher", []string{"web"}); err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(setPath, "some-path"); diff != "" {
+					t.Fatalf("launcher did not set PATH: (-got +want)\n%s\n", diff)
+				}
+				if len(syscallExecArgsColl) != 1 {
+					t.Fatalf("expected syscall.Exec to be called once: actual %v\n", syscallExecArgsColl)
+				}
+				if diff := cmp.Diff(syscallExecArgsColl[0].argv0, "/bin/sh"); diff != "" {
+					t.Fatalf("syscall.Exec Argv did not match: (-got +want)\n%s\n", diff)
+				}
+				if diff := cmp.Diff(syscallExecArgsColl[0].argv, []string{"sh", "-c", `echo "$1"`, "some arg"}); diff != "" {
+					t.Fatalf("syscall.Exec Argv did not match: (-got +want)\n%s\n", diff)
+				}
+			})
+
+			it("should fail if the start command requires a shell", func() {
+				launcher.Processes[0].Command = "some-process | other-process"
+
+				err := launcher.Launch("/path/to/launcher", []string{"web"})
+				if err == nil || !strings.Contains(err.Error(), "process type 'web' cannot run without a shell") {
+					t.Fatalf("expected error naming the process type, got: %v", err)
+				}
+			})
+		})
+
 		when("buildpacks have provided layer directories that could affect the environment", func() {
 			it.Before(func() {
 				mkfile(t, "#!/usr/bin/env bash\necho test1: $TEST_ENV_ONE test2: $TEST_ENV_TWO\n",
@@ -294,6 +393,26 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 					t.Fatalf("syscall.Exec stdout did not match: (-got +want)\n%s\n", diff)
 				}
 			})
+
+			it("should apply the env of the selected process type only", func() {
+				mkdir(t,
+					filepath.Join(tmpDir, "launch", "bp.1", "layer1", "env.launch", "start"),
+					filepath.Join(tmpDir, "launch", "bp.1", "layer1", "env.launch", "worker"),
+					filepath.Join(tmpDir, "launch", "bp.2", "layer4", "env.launch", "worker"),
+				)
+				gomock.InOrder(
+					env.EXPECT().AddEnvDir(filepath.Join(tmpDir, "launch", "bp.1", "layer1", "env.launch")),
+					env.EXPECT().AddEnvDir(filepath.Join(tmpDir, "launch", "bp.1", "layer1", "env.launch", "start")),
+				)
+				env.EXPECT().AddEnvDir(filepath.Join(tmpDir, "launch", "bp.1", "layer1", "env.launch", "worker")).Times(0)
+				env.EXPECT().AddEnvDir(filepath.Join(tmpDir, "launch", "bp.2", "layer4", "env.launch", "worker")).Times(0)
+				env.EXPECT().AddRootDir(gomock.Any()).AnyTimes()
+				env.EXPECT().AddEnvDir(gomock.Any()).AnyTimes()
+
+				if err := launcher.Launch("/path/to/launcher", []string{"start"}); err != nil {
+					t.Fatal(err)
+				}
+			})
 		})
 
 		when("metadata includes buildpacks that have not contributed layers", func() {
@@ -311,6 +430,64 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 
+		when("buildpacks have provided exec.d executables", func() {
+			it.Before(func() {
+				launcher.Processes = []launch.Process{
+					{Type: "start", Command: "./start"},
+				}
+				launcher.Buildpacks = []launch.Buildpack{{ID: "bp.1"}, {ID: "bp.2"}}
+
+				mkdir(t,
+					filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "start"),
+					filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "worker"),
+					filepath.Join(tmpDir, "launch", "bp.2", "layer2", "exec.d"),
+				)
+				mkfile(t, "#!/usr/bin/env bash\necho 'VAR_ONE = \"one\"' >&3\n",
+					filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "one"),
+				)
+				mkfile(t, "#!/usr/bin/env bash\necho \"VAR_START = \\\"$TEST_ENV_ONE\\\"\" >&3\n",
+					filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "start", "start"),
+				)
+				mkfile(t, "#!/usr/bin/env bash\necho 'VAR_WORKER = \"worker\"' >&3\n",
+					filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "worker", "worker"),
+				)
+				env.EXPECT().AddRootDir(gomock.Any()).AnyTimes()
+				env.EXPECT().AddEnvDir(gomock.Any()).AnyTimes()
+			})
+
+			it("should set the env vars they output for the selected process type", func() {
+				mkfile(t, "#!/usr/bin/env bash\necho 'VAR_TWO = \"two\"' >&3\necho ignored\n",
+					filepath.Join(tmpDir, "launch", "bp.2", "layer2", "exec.d", "two"),
+				)
+				gomock.InOrder(
+					env.EXPECT().SetExecD("VAR_ONE", "one", filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "one")),
+					env.EXPECT().SetExecD("VAR_START", "1", filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "start", "start")),
+					env.EXPECT().SetExecD("VAR_TWO", "two", filepath.Join(tmpDir, "launch", "bp.2", "layer2", "exec.d", "two")),
+				)
+
+				if err := launcher.Launch("/path/to/launcher", []string{"start"}); err != nil {
+					t.Fatal(err)
+				}
+				if len(syscallExecArgsColl) != 1 {
+					t.Fatalf("expected syscall.Exec to be called once: actual %v\n", syscallExecArgsColl)
+				}
+			})
+
+			it("should fail if an executable writes invalid TOML", func() {
+				mkfile(t, "#!/usr/bin/env bash\necho 'VAR_TWO = 2' >&3\n",
+					filepath.Join(tmpDir, "launch", "bp.2", "layer2", "exec.d", "two"),
+				)
+				env.EXPECT().SetExecD(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+				if err := launcher.Launch("/path/to/launcher", []string{"start"}); err == nil {
+					t.Fatal("expected launch to return an error")
+				}
+				if len(syscallExecArgsColl) != 0 {
+					t.Fatalf("expected syscall.Exec to not be called: actual %v\n", syscallExecArgsColl)
+				}
+			})
+		})
+
 		when("buildpacks have provided profile.d scripts", func() {
 			it.Before(func() {
 				mkfile(t, "#!/usr/bin/env bash\necho hi from app\n",
@@ -370,6 +547,52 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 				})
 			})
 
+			when("bash does not exist", func() {
+				it.Before(func() {
+					launcher.Bash = filepath.Join(tmpDir, "no-bash")
+				})
+
+				it("should run POSIX scripts with sh", func() {
+					if err := launcher.Launch("/path/to/launcher", []string{"start"}); err != nil {
+						t.Fatal(err)
+					}
+
+					stdout := rdfile(t, filepath.Join(tmpDir, "stdout"))
+					if len(stdout) == 0 {
+						stderr := rdfile(t, filepath.Join(tmpDir, "stderr"))
+						t.Fatalf("stdout was empty: stderr: %s\n", stderr)
+					}
+					if diff := cmp.Diff(stdout, "apple\nbanana\nhi from app\n"); diff != "" {
+						t.Fatalf("syscall.Exec stdout did not match: (-got +want)\n%s\n", diff)
+					}
+				})
+
+				it("should fail if a script requires bash", func() {
+					mkfile(t, "#!/usr/bin/env bash\necho cherry", filepath.Join(tmpDir, "launch", "bp.2", "layer", "profile.d", "cherry"))
+
+					err := launcher.Launch("/path/to/launcher", []string{"start"})
+					if err == nil || !strings.Contains(err.Error(), "process type 'start' requires") {
+						t.Fatalf("expected error naming the process type, got: %v", err)
+					}
+					if len(syscallExecArgsColl) != 0 {
+						t.Fatalf("expected syscall.Exec not to be called: actual %v\n", syscallExecArgsColl)
+					}
+				})
+
+				it("should fail if a script without a shebang uses bash syntax", func() {
+					mkfile(t, "fruits=(cherry date)\necho ${fruits[0]}", filepath.Join(tmpDir, "launch", "bp.2", "layer", "profile.d", "cherry"))
+
+					err := launcher.Launch("/path/to/launcher", []string{"start"})
+					if err == nil || !strings.Contains(err.Error(), "process type 'start' requires") ||
+						!strings.Contains(err.Error(), filepath.Join("profile.d", "cherry")+" is not a POSIX shell script") {
+						t.Fatalf("expected error naming the process type and script, got: %v", err)
+					}
+					if len(syscallExecArgsColl) != 0 {
+						t.Fatalf("expected syscall.Exec not to be called: actual %v\n", syscallExecArgsColl)
+					}
+				})
+			})
+
 			when("app has '.profile'", func() {
 				it.Before(func() {
 					mkfile(t, "echo from profile",
@@ -394,6 +617,175 @@ func testLauncher(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 	})
+
+	when("#LaunchAll", func() {
+		var (
+			self           string
+			stdout, stderr bytes.Buffer
+		)
+
+		// fakeLauncher writes a launcher that runs a script for each process type
+		fakeLauncher := func(web, worker string) {
+			mkfile(t, "#!/bin/sh\ncase \"$1\" in\n  web) "+web+" ;;\n  worker) "+worker+" ;;\nesac\n", self)
+		}
+
+		it.Before(func() {
+			self = filepath.Join(tmpDir, "launcher")
+			stdout.Reset()
+			stderr.Reset()
+			launcher.StopTimeout = 100 * time.Millisecond
+		})
+
+		it("should prefix output and stop all processes when one exits", func() {
+			fakeLauncher("echo serving; exec sleep 10", "sleep 0.2; echo failing >&2; exit 3")
+
+			status, err := launcher.LaunchAll(self, []string{"web", "worker"}, &stdout, &stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != 3 {
+				t.Fatalf("expected status 3, got %d", status)
+			}
+			if diff := cmp.Diff(stdout.String(), "[web] serving\n"); diff != "" {
+				t.Fatalf("stdout did not match: (-got +want)\n%s\n", diff)
+			}
+			// the exit may be detected before the output is copied
+			for _, line := range []string{
+				"[worker] failing\n",
+				"process type worker exited unexpectedly with status 3, stopping all processes\n",
+			} {
+				if !strings.Contains(stderr.String(), line) {
+					t.Fatalf("expected stderr to contain %q, got:\n%s\n", line, stderr.String())
+				}
+			}
+		})
+
+		it("should fail if a process exits successfully", func() {
+			fakeLauncher("exec sleep 10", "exit 0")
+
+			status, err := launcher.LaunchAll(self, []string{"web", "worker"}, &stdout, &stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != 1 {
+				t.Fatalf("expected status 1, got %d", status)
+			}
+		})
+
+		it("should kill processes that do not stop within the timeout", func() {
+			fakeLauncher("trap '' TERM; exec sleep 10", "sleep 0.2; exit 3")
+
+			start := time.Now()
+			status, err := launcher.LaunchAll(self, []string{"web", "worker"}, &stdout, &stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != 3 {
+				t.Fatalf("expected status 3, got %d", status)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("expected processes to be killed, took %s", elapsed)
+			}
+			if !strings.Contains(stderr.String(), "processes did not stop within 100ms, killing them\n") {
+				t.Fatalf("unexpected stderr: %s", stderr.String())
+			}
+		})
+
+		it("should stop all processes when one exits while its output is held open", func() {
+			fakeLauncher("exec sleep 10", "sleep 10 & exit 3")
+
+			start := time.Now()
+			status, err := launcher.LaunchAll(self, []string{"web", "worker"}, &stdout, &stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != 3 {
+				t.Fatalf("expected status 3, got %d", status)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("expected the exit to be detected, took %s", elapsed)
+			}
+		})
+
+		it("should not pass the process types to the processes", func() {
+			os.Setenv("CNB_PROCESS_TYPE", "web,worker")
+			defer os.Unsetenv("CNB_PROCESS_TYPE")
+			fakeLauncher(`echo "types=$CNB_PROCESS_TYPE"; exec sleep 10`, "sleep 0.2; exit 3")
+
+			if _, err := launcher.LaunchAll(self, []string{"web", "worker"}, &stdout, &stderr); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(stdout.String(), "[web] types=\n"); diff != "" {
+				t.Fatalf("stdout did not match: (-got +want)\n%s\n", diff)
+			}
+		})
+
+		it("should report the exit status when reaping as an init process", func() {
+			launcher.Init = true
+			fakeLauncher("exec sleep 10", "sleep 10 & sleep 0.2; exit 3")
+
+			status, err := launcher.LaunchAll(self, []string{"web", "worker"}, &stdout, &stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status != 3 {
+				t.Fatalf("expected status 3, got %d", status)
+			}
+			if !strings.Contains(stderr.String(), "process type worker exited unexpectedly with status 3, stopping all processes\n") {
+				t.Fatalf("unexpected stderr: %s", stderr.String())
+			}
+		})
+
+		it("should fail if a process type is not found", func() {
+			if _, err := launcher.LaunchAll(self, []string{"web", "missing"}, ioutil.Discard, ioutil.Discard); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	})
+
+	when("#ProcessEnv", func() {
+		it.Before(func() {
+			launcher.Buildpacks = []launch.Buildpack{{ID: "bp.1"}}
+			mkdir(t, filepath.Join(tmpDir, "launch", "bp.1", "layer1", "env.launch", "web"))
+			mkdir(t, filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d"))
+			mkfile(t, "#!/bin/sh\necho ran > "+filepath.Join(tmpDir, "ran")+"\n",
+				filepath.Join(tmpDir, "launch", "bp.1", "layer1", "exec.d", "exec"),
+			)
+		})
+
+		it("should return the env of the process type without launching it", func() {
+			env.EXPECT().AddEnvDir(filepath.Join(tmpDir, "launch", "bp.1", "layer1", "env.launch", "web"))
+			env.EXPECT().AddRootDir(gomock.Any()).AnyTimes()
+			env.EXPECT().AddEnvDir(gomock.Any()).AnyTimes()
+
+			vars, err := launcher.ProcessEnv("web")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(vars, envList); diff != "" {
+				t.Fatalf("env did not match: (-got +want)\n%s\n", diff)
+			}
+			if len(syscallExecArgsColl) != 0 {
+				t.Fatalf("expected syscall.Exec not to be called: actual %v\n", syscallExecArgsColl)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "ran")); !os.IsNotExist(err) {
+				t.Fatalf("expected exec.d executables not to run: %v", err)
+			}
+		})
+
+		it("should fail if the process type is not found", func() {
+			if _, err := launcher.ProcessEnv("missing"); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	})
 }
 
 func syscallExecWithStdout(t *testing.T, tmpDir string) func(argv0 string, argv []string, envv []string) error {
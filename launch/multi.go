@@ -0,0 +1,225 @@
+package launch
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/internal/procutil"
+)
+
+const defaultStopTimeout = 10 * time.Second
+
+// LaunchAll runs each of the process types by executing the launcher at self
+// as a child process, so that every process type is started with its own env,
+// exec.d and profile.d scripts. Lines written by each process are prefixed
+// with its type. Interrupt and terminate signals are forwarded to every
+// process.
+//
+// Once any process exits, the others are terminated, and their process groups
+// are killed if they have not exited within the stop timeout. If a process
+// exits without being signaled, LaunchAll returns its exit status, or 1 if it
+// exited successfully. If the launcher was signaled, it returns the first
+// non-zero exit status.
+//
+// Each child launcher inherits the environment without CNB_PROCESS_TYPE. If
+// Init is set, the launcher also reaps any orphaned processes re-parented to
+// it while the process types are running.
+func (l *Launcher) LaunchAll(self string, types []string, stdout, stderr io.Writer) (int, error) {
+	for _, processType := range types {
+		if _, ok := l.findProcessType(processType); !ok {
+			return 0, fmt.Errorf("process type %s was not found", processType)
+		}
+	}
+	stopTimeout := l.StopTimeout
+	if stopTimeout == 0 {
+		stopTimeout = defaultStopTimeout
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	type exit struct {
+		processType string
+		status      int
+	}
+	var (
+		exits   = make(chan exit, len(types))
+		procs   []*os.Process
+		pids    = map[int]string{}
+		readers []*os.File
+		copiers sync.WaitGroup
+	)
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+	stdout, stderr = procutil.NewLockedWriter(stdout), procutil.NewLockedWriter(stderr)
+	copyLines := func(r *os.File, w io.Writer, prefix string) {
+		readers = append(readers, r)
+		copiers.Add(1)
+		go func() {
+			defer copiers.Done()
+			prefixLines(r, w, prefix)
+		}()
+	}
+
+	env := childEnv(os.Environ())
+	for _, processType := range types {
+		cmd := exec.Command(self, processType)
+		cmd.Env = env
+		procutil.SetProcessGroup(cmd)
+		outR, outW, err := os.Pipe()
+		if err != nil {
+			killAll(procs)
+			return 0, err
+		}
+		errR, errW, err := os.Pipe()
+		if err != nil {
+			outR.Close()
+			outW.Close()
+			killAll(procs)
+			return 0, err
+		}
+		cmd.Stdout, cmd.Stderr = outW, errW
+		err = cmd.Start()
+		outW.Close()
+		errW.Close()
+		prefix := "[" + processType + "] "
+		copyLines(outR, stdout, prefix)
+		copyLines(errR, stderr, prefix)
+		if err != nil {
+			killAll(procs)
+			return 0, errors.Wrapf(err, "start process type %s", processType)
+		}
+		procs = append(procs, cmd.Process)
+		pids[cmd.Process.Pid] = processType
+		if l.Init {
+			continue
+		}
+
+		// the exit is detected independently of the output, which may be held
+		// open by the children of the process
+		go func(processType string, cmd *exec.Cmd) {
+			status := 1
+			if err := cmd.Wait(); err == nil || cmd.ProcessState != nil {
+				status = exitStatus(cmd.ProcessState)
+			}
+			exits <- exit{processType: processType, status: status}
+		}(processType, cmd)
+	}
+	if l.Init {
+		// the reaper waits for the processes instead, since waiting for any
+		// process would race with exec.Cmd
+		stop, err := startReaper(pids, func(processType string, status int) {
+			exits <- exit{processType: processType, status: status}
+		})
+		if err != nil {
+			killAll(procs)
+			return 0, err
+		}
+		defer stop()
+	}
+
+	var (
+		first    exit
+		signaled bool
+	)
+	for waiting := true; waiting; {
+		select {
+		case sig := <-sigs:
+			signaled = true
+			for _, proc := range procs {
+				_ = proc.Signal(sig)
+			}
+		case first = <-exits:
+			waiting = false
+		}
+	}
+	status := first.status
+	if !signaled {
+		fmt.Fprintf(stderr, "process type %s exited unexpectedly with status %d, stopping all processes\n", first.processType, first.status)
+		if status == 0 {
+			status = 1
+		}
+	}
+
+	terminateAll(procs)
+	timeout := time.After(stopTimeout)
+	for remaining := len(procs) - 1; remaining > 0; {
+		select {
+		case e := <-exits:
+			remaining--
+			if status == 0 {
+				status = e.status
+			}
+		case <-timeout:
+			fmt.Fprintf(stderr, "processes did not stop within %s, killing them\n", stopTimeout)
+			killAll(procs)
+			timeout = nil
+		}
+	}
+
+	// output held open by orphaned children is abandoned after the timeout
+	copied := make(chan struct{})
+	go func() {
+		copiers.Wait()
+		close(copied)
+	}()
+	select {
+	case <-copied:
+	case <-time.After(stopTimeout):
+	}
+	return status, nil
+}
+
+func childEnv(environ []string) []string {
+	var env []string
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, "CNB_PROCESS_TYPE=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+func terminateAll(procs []*os.Process) {
+	for _, proc := range procs {
+		if err := proc.Signal(syscall.SIGTERM); err != nil {
+			_ = proc.Kill()
+		}
+	}
+}
+
+func killAll(procs []*os.Process) {
+	for _, proc := range procs {
+		_ = procutil.KillProcessGroup(proc)
+	}
+}
+
+func prefixLines(r io.Reader, w io.Writer, prefix string) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			if line[len(line)-1] != '\n' {
+				line += "\n"
+			}
+			_, _ = w.Write([]byte(prefix + line))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package launch
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// shellFor returns the shell that runs the process: bash if it exists,
+// otherwise sh if the profile scripts do not require bash. It returns an empty
+// string if neither exists and there are no profile scripts to source.
+func (l *Launcher) shellFor(process Process, scripts []string) (string, error) {
+	bash, sh := l.Bash, l.Sh
+	if bash == "" {
+		bash = "/bin/bash"
+	}
+	if sh == "" {
+		sh = "/bin/sh"
+	}
+	if fileExists(bash) {
+		return bash, nil
+	}
+	if !fileExists(sh) {
+		if len(scripts) > 0 {
+			return "", fmt.Errorf("%s requires a shell to source %s, but neither %s nor %s exists", describeProcess(process), scripts[0], bash, sh)
+		}
+		return "", nil
+	}
+	for _, script := range scripts {
+		if err := checkNotBash(script); err != nil {
+			return "", errors.Wrapf(err, "%s requires %s, which does not exist", describeProcess(process), bash)
+		}
+	}
+	if err := checkPOSIX(sh, scripts); err != nil {
+		return "", errors.Wrapf(err, "%s requires %s, which does not exist", describeProcess(process), bash)
+	}
+	return sh, nil
+}
+
+func checkNotBash(script string) error {
+	f, err := os.Open(script)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return nil
+	}
+	if strings.HasPrefix(line, "#!") && strings.Contains(line, "bash") {
+		return errors.Errorf("%s is a bash script", script)
+	}
+	return nil
+}
+
+// The scripts are parsed together so that sh only runs once, and then one at a
+// time to find the script that fails.
+func checkPOSIX(sh string, scripts []string) error {
+	if len(scripts) == 0 {
+		return nil
+	}
+	var all bytes.Buffer
+	for _, script := range scripts {
+		contents, err := ioutil.ReadFile(script)
+		if err != nil {
+			return err
+		}
+		all.Write(contents)
+		all.WriteString("\n")
+	}
+	cmd := exec.Command(sh, "-n")
+	cmd.Stdin = &all
+	if err := cmd.Run(); err == nil {
+		return nil
+	}
+	for _, script := range scripts {
+		if out, err := exec.Command(sh, "-n", script).CombinedOutput(); err != nil {
+			return errors.Errorf("%s is not a POSIX shell script: %s", script, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func describeProcess(process Process) string {
+	if process.Type != "" {
+		return fmt.Sprintf("process type '%s'", process.Type)
+	}
+	return fmt.Sprintf("command '%s'", process.Command)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// tokenize splits a command into words without a shell. Words may be quoted
+// with single or double quotes, and backslash escapes the next character
+// outside of single quotes. $0 to $9 expand to args, as they would for
+// bash -c. Other expansions and shell operators are not supported.
+func tokenize(command string, args []string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '\'' || c == '"'):
+			quote, inWord = c, true
+		case c == '$' && quote != '\'':
+			if i+1 < len(runes) && runes[i+1] >= '0' && runes[i+1] <= '9' {
+				if n := int(runes[i+1] - '0'); n < len(args) {
+					word.WriteString(args[n])
+				}
+				i++
+				inWord = true
+				continue
+			}
+			return nil, errors.Errorf("unsupported expansion in '%s'", command)
+		case quote != 0:
+			word.WriteRune(c)
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case strings.ContainsRune("|&;<>()`*?[]#~{}", c):
+			return nil, errors.Errorf("unsupported shell syntax '%c' in '%s'", c, command)
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.Errorf("unterminated quote or escape in '%s'", command)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return words, nil
+}
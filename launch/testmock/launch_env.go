@@ -88,3 +88,15 @@ func (mr *MockEnvMockRecorder) List() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockEnv)(nil).List))
 }
+
+// SetExecD mocks base method
+func (m *MockEnv) SetExecD(arg0, arg1, arg2 string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetExecD", arg0, arg1, arg2)
+}
+
+// SetExecD indicates an expected call of SetExecD
+func (mr *MockEnvMockRecorder) SetExecD(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExecD", reflect.TypeOf((*MockEnv)(nil).SetExecD), arg0, arg1, arg2)
+}
@@ -19,6 +19,7 @@ type BuildMetadata struct {
 	BOM        []BOMEntry       `toml:"bom" json:"bom"`
 	Launcher   LauncherMetadata `toml:"-" json:"launcher"`
 	Slices     []Slice          `toml:"slices" json:"-"`
+	Usage      []BuildpackUsage `toml:"usage,omitempty" json:"-"`
 }
 
 type LauncherMetadata struct {
@@ -46,6 +47,7 @@ func (md BuildMetadata) hasProcess(processType string) bool {
 
 type CacheMetadata struct {
 	Buildpacks []BuildpackLayersMetadata `json:"buildpacks"`
+	Detect     *DetectCacheMetadata      `json:"detect,omitempty"`
 }
 
 func (cm *CacheMetadata) MetadataForBuildpack(id string) BuildpackLayersMetadata {
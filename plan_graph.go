@@ -0,0 +1,113 @@
+package lifecycle
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// PlanGraph is the dependency graph of the build plan resolved for the
+// selected group, where each edge is a dependency supplied by one buildpack
+// to another.
+type PlanGraph struct {
+	Nodes []PlanGraphNode `json:"nodes"`
+	Edges []PlanGraphEdge `json:"edges"`
+}
+
+type PlanGraphNode struct {
+	Buildpack  Buildpack `json:"buildpack"`
+	Eliminated bool      `json:"eliminated,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	Name       string    `json:"name,omitempty"`
+}
+
+type PlanGraphEdge struct {
+	Name     string    `json:"name"`
+	Version  string    `json:"version,omitempty"`
+	Provider Buildpack `json:"provider"`
+	Requirer Buildpack `json:"requirer"`
+}
+
+func (g *PlanGraph) set(options detectTrial, eliminated []PlanGraphNode, deps depMap) {
+	g.Nodes = nil
+	g.Edges = nil
+
+	index := map[Buildpack]int{}
+	for i, option := range options {
+		index[option.Buildpack] = i
+		node := PlanGraphNode{Buildpack: option.Buildpack}
+		for _, e := range eliminated {
+			if e.Buildpack == option.Buildpack {
+				node = e
+				break
+			}
+		}
+		g.Nodes = append(g.Nodes, node)
+	}
+
+	for name, entry := range deps {
+		for _, provider := range entry.Providers {
+			for i, requirer := range entry.requirers {
+				g.Edges = append(g.Edges, PlanGraphEdge{
+					Name:     name,
+					Version:  entry.Requires[i].Version,
+					Provider: provider,
+					Requirer: requirer,
+				})
+			}
+		}
+	}
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if index[a.Provider] != index[b.Provider] {
+			return index[a.Provider] < index[b.Provider]
+		}
+		return index[a.Requirer] < index[b.Requirer]
+	})
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Eliminated
+// buildpacks are drawn dashed and labeled with the reason for elimination.
+func (g *PlanGraph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph plan {"); err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		id := dotID(n.Buildpack)
+		var err error
+		if n.Eliminated {
+			label := dotEscape(n.Buildpack.noOpt().String()) + `\n` + dotEscape(n.Reason+" "+n.Name)
+			_, err = fmt.Fprintf(w, "  %s [style=dashed, label=\"%s\"];\n", id, label)
+		} else {
+			_, err = fmt.Fprintf(w, "  %s;\n", id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		label := e.Name
+		if e.Version != "" {
+			label += "@" + e.Version
+		}
+		if _, err := fmt.Fprintf(w, "  %s -> %s [label=\"%s\"];\n", dotID(e.Provider), dotID(e.Requirer), dotEscape(label)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+func dotID(bp Buildpack) string {
+	return `"` + dotEscape(bp.noOpt().String()) + `"`
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func dotEscape(s string) string {
+	return dotEscaper.Replace(s)
+}
@@ -0,0 +1,54 @@
+package lifecycle
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/internal/procutil"
+)
+
+// runCmd runs cmd to completion, killing its entire process group if ctx is
+// done or timeout (when non-zero) expires first.
+func runCmd(ctx context.Context, cmd *exec.Cmd, timeout time.Duration) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	procutil.SetProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if err := procutil.KillProcessGroup(cmd.Process); err != nil {
+			return errors.Wrap(err, "kill process group")
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+func timeoutErr(err error, bp Buildpack, phase string, timeout time.Duration) error {
+	if err == context.DeadlineExceeded {
+		return errors.Errorf("buildpack %s timed out after %s during %s", bp, timeout, phase)
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package semver
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Constraint is a set of version ranges, such as ">=1.2.0 <2.0.0 || ^3.1".
+// The zero value matches every version.
+type Constraint struct {
+	ranges []versionRange
+	empty  bool
+}
+
+type bound struct {
+	version   Version
+	inclusive bool
+	unbounded bool
+}
+
+type versionRange struct {
+	lower, upper bound
+	prerelease   []Version // releases whose prereleases the range may match
+}
+
+// ParseConstraint parses a constraint made up of ranges separated by "||", where
+// each range is a list of comparators (=, >, >=, <, <=, ^, ~) separated by
+// spaces or commas. Partial versions such as "12" or "1.2.x" match every
+// version sharing their leading components. An empty constraint or "*" matches
+// every version. A prerelease version only matches a range with a comparator
+// naming a prerelease of the same release, so that "^1.0" does not match
+// "2.0.0-rc.1".
+func ParseConstraint(s string) (Constraint, error) {
+	var c Constraint
+	for _, or := range strings.Split(s, "||") {
+		r, err := parseRange(or)
+		if err != nil {
+			return Constraint{}, errors.Wrapf(err, "parsing constraint '%s'", s)
+		}
+		c.ranges = append(c.ranges, r)
+	}
+	return c, nil
+}
+
+func MustParseConstraint(s string) Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func parseRange(s string) (versionRange, error) {
+	r := versionRange{lower: bound{unbounded: true}, upper: bound{unbounded: true}}
+	var prerelease []Version
+	for _, comp := range strings.Fields(strings.Replace(s, ",", " ", -1)) {
+		cr, err := parseComparator(comp)
+		if err != nil {
+			return versionRange{}, err
+		}
+		r = r.intersect(cr)
+		prerelease = append(prerelease, cr.prerelease...)
+	}
+	r.prerelease = prerelease
+	return r, nil
+}
+
+func parseComparator(s string) (versionRange, error) {
+	rest := strings.TrimLeft(s, "<>=~^")
+	op := s[:len(s)-len(rest)]
+	p, err := parsePartial(rest)
+	if err != nil {
+		return versionRange{}, err
+	}
+	inf := bound{unbounded: true}
+	lower := bound{version: p.Version, inclusive: true, unbounded: p.parts == 0}
+	upper := bound{version: p.next(), inclusive: p.parts == 3, unbounded: p.parts == 0}
+	var pre []Version
+	if p.Pre != "" {
+		pre = []Version{p.release()}
+	}
+
+	switch op {
+	case "", "=", "==":
+		return versionRange{lower: lower, upper: upper, prerelease: pre}, nil
+	case ">=":
+		return versionRange{lower: lower, upper: inf, prerelease: pre}, nil
+	case ">":
+		if p.parts == 0 {
+			return versionRange{lower: bound{}, upper: bound{}}, nil
+		}
+		return versionRange{lower: bound{version: upper.version, inclusive: !upper.inclusive}, upper: inf, prerelease: pre}, nil
+	case "<=":
+		return versionRange{lower: inf, upper: upper, prerelease: pre}, nil
+	case "<":
+		if p.parts == 0 {
+			return versionRange{lower: bound{}, upper: bound{}}, nil
+		}
+		return versionRange{lower: inf, upper: bound{version: lower.version}, prerelease: pre}, nil
+	case "~":
+		if p.parts == 3 {
+			upper = bound{version: Version{Major: p.Major, Minor: p.Minor + 1}}
+		}
+		return versionRange{lower: lower, upper: upper, prerelease: pre}, nil
+	case "^":
+		switch {
+		case p.parts == 0:
+		case p.Major != 0 || p.parts == 1:
+			upper = bound{version: Version{Major: p.Major + 1}}
+		case p.Minor != 0 || p.parts == 2:
+			upper = bound{version: Version{Minor: p.Minor + 1}}
+		default:
+			upper = bound{version: Version{Patch: p.Patch + 1}}
+		}
+		return versionRange{lower: lower, upper: upper, prerelease: pre}, nil
+	}
+	return versionRange{}, errors.Errorf("unknown operator '%s'", op)
+}
+
+// Check reports whether v satisfies the constraint.
+func (c Constraint) Check(v Version) bool {
+	if c.ranges == nil {
+		return !c.empty
+	}
+	for _, r := range c.ranges {
+		if r.contains(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect returns the constraint satisfied by versions that satisfy both c and o.
+func (c Constraint) Intersect(o Constraint) Constraint {
+	if c.empty || o.empty {
+		return Constraint{empty: true}
+	}
+	if c.ranges == nil {
+		return o
+	}
+	if o.ranges == nil {
+		return c
+	}
+	out := Constraint{empty: true}
+	for _, a := range c.ranges {
+		for _, b := range o.ranges {
+			if r := a.intersect(b); !r.isEmpty() {
+				out.ranges = append(out.ranges, r)
+				out.empty = false
+			}
+		}
+	}
+	return out
+}
+
+// Empty reports whether no version can satisfy the constraint.
+func (c Constraint) Empty() bool {
+	if c.ranges == nil {
+		return c.empty
+	}
+	for _, r := range c.ranges {
+		if !r.isEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r versionRange) contains(v Version) bool {
+	if v.Pre != "" && !r.allowsPrerelease(v) {
+		return false
+	}
+	if !r.lower.unbounded {
+		c := v.Compare(r.lower.version)
+		if c < 0 || c == 0 && !r.lower.inclusive {
+			return false
+		}
+	}
+	if !r.upper.unbounded {
+		c := v.Compare(r.upper.version)
+		if c > 0 || c == 0 && !r.upper.inclusive {
+			return false
+		}
+	}
+	return true
+}
+
+func (r versionRange) intersect(o versionRange) versionRange {
+	return versionRange{
+		lower:      maxLower(r.lower, o.lower),
+		upper:      minUpper(r.upper, o.upper),
+		prerelease: r.intersectPrerelease(o),
+	}
+}
+
+func (r versionRange) allowsPrerelease(v Version) bool {
+	for _, p := range r.prerelease {
+		if p == v.release() {
+			return true
+		}
+	}
+	return false
+}
+
+func (r versionRange) intersectPrerelease(o versionRange) []Version {
+	var out []Version
+	for _, p := range r.prerelease {
+		if o.allowsPrerelease(p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (r versionRange) isEmpty() bool {
+	lower, upper := r.lower, r.upper
+	if len(r.prerelease) == 0 {
+		// only releases can match, so move prerelease bounds to the nearest release
+		if !lower.unbounded && lower.version.Pre != "" {
+			lower = bound{version: lower.version.release(), inclusive: true}
+		}
+		if !upper.unbounded && upper.version.Pre != "" {
+			upper = bound{version: upper.version.release()}
+		}
+	}
+	if lower.unbounded || upper.unbounded {
+		return false
+	}
+	c := lower.version.Compare(upper.version)
+	return c > 0 || c == 0 && !(lower.inclusive && upper.inclusive)
+}
+
+func maxLower(a, b bound) bound {
+	switch {
+	case a.unbounded:
+		return b
+	case b.unbounded:
+		return a
+	}
+	switch c := a.version.Compare(b.version); {
+	case c > 0:
+		return a
+	case c < 0:
+		return b
+	}
+	a.inclusive = a.inclusive && b.inclusive
+	return a
+}
+
+func minUpper(a, b bound) bound {
+	switch {
+	case a.unbounded:
+		return b
+	case b.unbounded:
+		return a
+	}
+	switch c := a.version.Compare(b.version); {
+	case c < 0:
+		return a
+	case c > 0:
+		return b
+	}
+	a.inclusive = a.inclusive && b.inclusive
+	return a
+}
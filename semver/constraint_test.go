@@ -0,0 +1,86 @@
+package semver_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/semver"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestConstraint(t *testing.T) {
+	spec.Run(t, "Constraint", testConstraint, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testConstraint(t *testing.T, when spec.G, it spec.S) {
+	when("#Check", func() {
+		for _, tc := range []struct {
+			constraint string
+			matches    []string
+			misses     []string
+		}{
+			{"", []string{"0.0.1", "12.3.4"}, []string{"12.3.4-rc.1"}},
+			{"*", []string{"0.0.1", "12.3.4"}, []string{"12.3.4-rc.1"}},
+			{"1.2.3", []string{"1.2.3"}, []string{"1.2.4", "1.2.3-rc.1"}},
+			{"12", []string{"12.0.0", "12.9.1"}, []string{"11.9.9", "13.0.0"}},
+			{"1.2.x", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+			{">=1.2 <2", []string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0"}},
+			{">1.2.3, <=1.3", []string{"1.2.4", "1.3.9"}, []string{"1.2.3", "1.4.0"}},
+			{">12", []string{"13.0.0"}, []string{"12.9.9"}},
+			{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+			{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+			{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+			{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+			{"^1.0 || ^3.1", []string{"1.5.0", "3.2.0"}, []string{"2.0.0", "3.0.9"}},
+			{"^1.0", []string{"1.5.0"}, []string{"1.5.0-rc.1", "2.0.0-rc.1"}},
+			{"<2.0.0", []string{"1.9.9"}, []string{"2.0.0-rc.1"}},
+			{"2.0.0-rc.1", []string{"2.0.0-rc.1"}, []string{"2.0.0-rc.2", "2.0.0"}},
+			{">=2.0.0-rc.1 <3", []string{"2.0.0-rc.2", "2.0.0", "2.5.0"}, []string{"2.0.0-beta", "2.5.0-beta", "3.0.0-rc.1"}},
+		} {
+			tc := tc
+			it("matches versions against '"+tc.constraint+"'", func() {
+				c, err := semver.ParseConstraint(tc.constraint)
+				h.AssertNil(t, err)
+				for _, v := range tc.matches {
+					if !c.Check(mustParse(t, v)) {
+						t.Fatalf("expected '%s' to match '%s'", tc.constraint, v)
+					}
+				}
+				for _, v := range tc.misses {
+					if c.Check(mustParse(t, v)) {
+						t.Fatalf("expected '%s' not to match '%s'", tc.constraint, v)
+					}
+				}
+			})
+		}
+
+		it("fails to parse invalid constraints", func() {
+			_, err := semver.ParseConstraint(">=foo")
+			h.AssertError(t, err, "parsing constraint '>=foo'")
+		})
+	})
+
+	when("#Intersect", func() {
+		it("is empty when the constraints do not overlap", func() {
+			h.AssertEq(t, semver.MustParseConstraint("12").Intersect(semver.MustParseConstraint("14")).Empty(), true)
+			h.AssertEq(t, semver.MustParseConstraint("<1.2.3").Intersect(semver.MustParseConstraint(">=1.2.3")).Empty(), true)
+			h.AssertEq(t, semver.MustParseConstraint("2.0.0-rc.1").Intersect(semver.MustParseConstraint("<2.0.0")).Empty(), true)
+		})
+
+		it("is not empty when the constraints overlap", func() {
+			c := semver.MustParseConstraint(">=12").Intersect(semver.MustParseConstraint("^12.4 || 14"))
+			h.AssertEq(t, c.Empty(), false)
+			h.AssertEq(t, c.Check(mustParse(t, "12.5.0")), true)
+			h.AssertEq(t, c.Check(mustParse(t, "12.3.0")), false)
+			h.AssertEq(t, c.Check(mustParse(t, "14.1.0")), true)
+		})
+
+		it("matches everything for the zero value", func() {
+			var c semver.Constraint
+			h.AssertEq(t, c.Empty(), false)
+			h.AssertEq(t, c.Intersect(semver.MustParseConstraint("12")).Check(mustParse(t, "12.1.0")), true)
+		})
+	})
+}
@@ -0,0 +1,143 @@
+// Package semver implements the subset of semantic versioning needed to match
+// buildpack and build plan versions against version constraints.
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var versionRegex = regexp.MustCompile(`^v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+type Version struct {
+	Major, Minor, Patch uint64
+	Pre                 string
+}
+
+// Parse parses a version, filling in a missing minor or patch component with zero.
+func Parse(s string) (Version, error) {
+	p, err := parsePartial(s)
+	if err != nil {
+		return Version{}, err
+	}
+	if p.parts == 0 {
+		return Version{}, errors.Errorf("could not parse '%s' as version", s)
+	}
+	return p.Version, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to or greater than o.
+func (v Version) Compare(o Version) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+func (v Version) release() Version {
+	v.Pre = ""
+	return v
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		var c int
+		switch {
+		case aErr == nil && bErr == nil:
+			c = compareUint(an, bn)
+		case aErr == nil:
+			c = -1
+		case bErr == nil:
+			c = 1
+		default:
+			c = strings.Compare(as[i], bs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(as)), uint64(len(bs)))
+}
+
+// partial is a version where only the first parts components were provided.
+type partial struct {
+	Version
+	parts int
+}
+
+func parsePartial(s string) (partial, error) {
+	matches := versionRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return partial{}, errors.Errorf("could not parse '%s' as version", s)
+	}
+	var (
+		p    partial
+		nums [3]uint64
+	)
+	for i, m := range matches[1:4] {
+		if m == "" || m == "x" || m == "X" || m == "*" {
+			break
+		}
+		n, err := strconv.ParseUint(m, 10, 64)
+		if err != nil {
+			return partial{}, errors.Wrapf(err, "parsing version '%s'", s)
+		}
+		nums[i] = n
+		p.parts++
+	}
+	p.Major, p.Minor, p.Patch = nums[0], nums[1], nums[2]
+	if p.parts == 3 {
+		p.Pre = matches[4]
+	}
+	return p, nil
+}
+
+// next returns the smallest version greater than every version matching p.
+func (p partial) next() Version {
+	switch p.parts {
+	case 1:
+		return Version{Major: p.Major + 1}
+	case 2:
+		return Version{Major: p.Major, Minor: p.Minor + 1}
+	}
+	return p.Version
+}
@@ -0,0 +1,57 @@
+package semver_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle/semver"
+	h "github.com/buildpacks/lifecycle/testhelpers"
+)
+
+func TestVersion(t *testing.T) {
+	spec.Run(t, "Version", testVersion, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testVersion(t *testing.T, when spec.G, it spec.S) {
+	when("#Parse", func() {
+		it("parses full versions", func() {
+			v, err := semver.Parse("1.2.3-rc.1+build")
+			h.AssertNil(t, err)
+			h.AssertEq(t, v, semver.Version{Major: 1, Minor: 2, Patch: 3, Pre: "rc.1"})
+		})
+
+		it("fills in missing components", func() {
+			v, err := semver.Parse("v1.2")
+			h.AssertNil(t, err)
+			h.AssertEq(t, v.String(), "1.2.0")
+		})
+
+		it("fails to parse invalid versions", func() {
+			_, err := semver.Parse("v1.clear")
+			h.AssertError(t, err, "could not parse 'v1.clear' as version")
+		})
+	})
+
+	when("#Compare", func() {
+		it("orders by major, minor and patch", func() {
+			h.AssertEq(t, mustParse(t, "1.2.3").Compare(mustParse(t, "1.10.0")), -1)
+			h.AssertEq(t, mustParse(t, "2.0.0").Compare(mustParse(t, "1.10.0")), 1)
+			h.AssertEq(t, mustParse(t, "1.2.3").Compare(mustParse(t, "1.2.3")), 0)
+		})
+
+		it("orders pre-releases before releases", func() {
+			h.AssertEq(t, mustParse(t, "1.2.3-alpha").Compare(mustParse(t, "1.2.3")), -1)
+			h.AssertEq(t, mustParse(t, "1.2.3-alpha.2").Compare(mustParse(t, "1.2.3-alpha.10")), -1)
+			h.AssertEq(t, mustParse(t, "1.2.3-beta").Compare(mustParse(t, "1.2.3-alpha")), 1)
+		})
+	})
+}
+
+func mustParse(t *testing.T, s string) semver.Version {
+	t.Helper()
+	v, err := semver.Parse(s)
+	h.AssertNil(t, err)
+	return v
+}
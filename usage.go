@@ -0,0 +1,106 @@
+package lifecycle
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ResourceUsage is the resources consumed by a buildpack's bin/detect or
+// bin/build, including any child processes that it waited for.
+type ResourceUsage struct {
+	WallTime   float64 `toml:"wall-time" json:"wallTime"`     // seconds
+	UserTime   float64 `toml:"user-time" json:"userTime"`     // seconds
+	SystemTime float64 `toml:"system-time" json:"systemTime"` // seconds
+	MaxRSS     int64   `toml:"max-rss" json:"maxRSS"`         // bytes
+}
+
+type BuildpackUsage struct {
+	Buildpack Buildpack `toml:"buildpack" json:"buildpack"`
+	ResourceUsage
+}
+
+func processUsage(state *os.ProcessState, wall time.Duration) ResourceUsage {
+	usage := ResourceUsage{WallTime: seconds(wall)}
+	if state == nil {
+		return usage
+	}
+	usage.UserTime = seconds(state.UserTime())
+	usage.SystemTime = seconds(state.SystemTime())
+	usage.MaxRSS = maxRSS(state)
+	return usage
+}
+
+func seconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
+
+// usageSummary returns a line for each buildpack, ranked by wall time.
+func usageSummary(usage []BuildpackUsage) []string {
+	ranked := append([]BuildpackUsage{}, usage...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].WallTime > ranked[j].WallTime
+	})
+	maxLength := 0
+	for _, u := range ranked {
+		if l := len(u.Buildpack.String()); l > maxLength {
+			maxLength = l
+		}
+	}
+	f := fmt.Sprintf("%%-%ds  wall %%.3fs  user %%.3fs  sys %%.3fs  max-rss %%.1f MiB", maxLength)
+
+	var lines []string
+	for _, u := range ranked {
+		lines = append(lines, fmt.Sprintf(f, u.Buildpack, u.WallTime, u.UserTime, u.SystemTime, float64(u.MaxRSS)/(1<<20)))
+	}
+	return lines
+}
+
+// usage returns the resources used by each bin/detect that was run.
+func (c *DetectConfig) usage() []BuildpackUsage {
+	var usage []BuildpackUsage
+	c.runs.Range(func(k, v interface{}) bool {
+		run := v.(detectRun)
+		if run.Usage == nil {
+			return true
+		}
+		id := strings.SplitN(k.(string), "@", 2)
+		usage = append(usage, BuildpackUsage{
+			Buildpack:     Buildpack{ID: id[0], Version: id[1]},
+			ResourceUsage: *run.Usage,
+		})
+		return true
+	})
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Buildpack.String() < usage[j].Buildpack.String()
+	})
+	return usage
+}
+
+func (c *DetectConfig) logUsage() {
+	if !c.LogUsage {
+		return
+	}
+	lines := usageSummary(c.usage())
+	if len(lines) == 0 {
+		return
+	}
+	c.Logger.Info("======== Detect resource usage ========")
+	for _, line := range lines {
+		c.Logger.Info(line)
+	}
+}
+
+func (b *Builder) logUsage(usage []BuildpackUsage) {
+	lines := usageSummary(usage)
+	if len(lines) == 0 {
+		return
+	}
+	b.Out.Printf("======== Build resource usage ========")
+	for _, line := range lines {
+		b.Out.Print(line)
+	}
+}
@@ -0,0 +1,20 @@
+// +build linux darwin
+
+package lifecycle
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func maxRSS(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss) // bytes
+	}
+	return int64(rusage.Maxrss) * 1024 // kilobytes
+}
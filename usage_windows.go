@@ -0,0 +1,7 @@
+package lifecycle
+
+import "os"
+
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -38,6 +38,46 @@ func ReadOrder(path string) (BuildpackOrder, error) {
 	return order.Order, err
 }
 
+// ReadOrderExtensions returns the buildpacks listed by every [[order-extensions]]
+// entry in the order file, in the order that they appear.
+func ReadOrderExtensions(path string) (OrderExtensions, error) {
+	var order struct {
+		Extensions []OrderExtensions `toml:"order-extensions"`
+	}
+	if _, err := toml.DecodeFile(path, &order); err != nil {
+		return OrderExtensions{}, err
+	}
+	var ext OrderExtensions
+	for _, e := range order.Extensions {
+		ext = ext.Append(e)
+	}
+	return ext, nil
+}
+
+// ParseBuildpackRefs returns the buildpacks referenced as <id>[@<version>][?],
+// where a trailing ? marks the buildpack as optional. Empty references are
+// ignored.
+func ParseBuildpackRefs(refs []string) []Buildpack {
+	var bps []Buildpack
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		var bp Buildpack
+		if strings.HasSuffix(ref, "?") {
+			ref = strings.TrimSpace(strings.TrimSuffix(ref, "?"))
+			bp.Optional = true
+		}
+		if ref == "" {
+			continue
+		}
+		bp.ID = ref
+		if i := strings.LastIndex(ref, "@"); i >= 0 {
+			bp.ID, bp.Version = ref[:i], ref[i+1:]
+		}
+		bps = append(bps, bp)
+	}
+	return bps
+}
+
 func TruncateSha(sha string) string {
 	rawSha := strings.TrimPrefix(sha, "sha256:")
 	if len(sha) > 12 {
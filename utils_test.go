@@ -54,6 +54,59 @@ func testUtils(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when(".ReadOrderExtensions", func() {
+		var tmpDir string
+
+		it.Before(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "lifecycle.test")
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+
+		it.After(func() {
+			os.RemoveAll(tmpDir)
+		})
+
+		it("should return the pre and post buildpacks of every extension", func() {
+			mkfile(t,
+				"[[order]]\n"+
+					`group = [{id = "A", version = "v1"}]`+"\n"+
+					"[[order-extensions]]\n"+
+					`pre = [{id = "B", version = "v1"}]`+"\n"+
+					`post = [{id = "C", optional = true}]`+"\n"+
+					"[[order-extensions]]\n"+
+					`pre = [{id = "D"}]`+"\n",
+				filepath.Join(tmpDir, "order.toml"),
+			)
+			actual, err := lifecycle.ReadOrderExtensions(filepath.Join(tmpDir, "order.toml"))
+			if err != nil {
+				t.Fatalf("Unexpected error:\n%s\n", err)
+			}
+			if s := cmp.Diff(actual, lifecycle.OrderExtensions{
+				Pre:  []lifecycle.Buildpack{{ID: "B", Version: "v1"}, {ID: "D"}},
+				Post: []lifecycle.Buildpack{{ID: "C", Optional: true}},
+			}); s != "" {
+				t.Fatalf("Unexpected extensions:\n%s\n", s)
+			}
+		})
+	})
+
+	when(".ParseBuildpackRefs", func() {
+		it("should parse ids, versions and optional markers", func() {
+			actual := lifecycle.ParseBuildpackRefs([]string{"A", " B@v1 ", "", "C?", "D@v2?", "?"})
+			if s := cmp.Diff(actual, []lifecycle.Buildpack{
+				{ID: "A"},
+				{ID: "B", Version: "v1"},
+				{ID: "C", Optional: true},
+				{ID: "D", Version: "v2", Optional: true},
+			}); s != "" {
+				t.Fatalf("Unexpected buildpacks:\n%s\n", s)
+			}
+		})
+	})
+
 	when(".ReadGroup", func() {
 		var tmpDir string
 
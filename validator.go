@@ -0,0 +1,128 @@
+package lifecycle
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/lifecycle/api"
+)
+
+type ValidateConfig struct {
+	BuildpacksDir string
+	BuildpackAPI  *api.Version
+	Extensions    OrderExtensions
+}
+
+// Validate statically checks the order and every buildpack it references,
+// including the orders of meta-buildpacks, without running detection.
+// Every problem found is returned rather than only the first.
+func (bo BuildpackOrder) Validate(c *ValidateConfig) []error {
+	if len(bo) == 0 {
+		return []error{errors.New("order is empty")}
+	}
+	var errs []error
+	bo = bo.extend(c.Extensions)
+	bo.validate(nil, "", c, func(err error) {
+		errs = append(errs, err)
+	})
+	return errs
+}
+
+// validate checks each group of the order, where parent describes the location
+// of the meta-buildpack that contains the order. Groups containing only optional
+// buildpacks are only reported at the top level, since meta-buildpacks may use
+// them to make their contents optional.
+func (bo BuildpackOrder) validate(path detectPath, parent string, c *ValidateConfig, fail func(error)) {
+	for i, group := range bo {
+		where := parent + "group " + strconv.Itoa(i+1)
+		groupFail := func(err error) {
+			fail(errors.Wrap(err, where))
+		}
+		if len(group.Group) == 0 {
+			groupFail(errors.New("group is empty"))
+			continue
+		}
+		optionalOnly := true
+		for _, bp := range group.Group {
+			optionalOnly = optionalOnly && bp.Optional
+			bp.validate(path, where, c, fail)
+		}
+		if optionalOnly && len(path) == 0 {
+			groupFail(errors.New("group contains only optional buildpacks"))
+		}
+	}
+}
+
+func (bp Buildpack) validate(path detectPath, where string, c *ValidateConfig, fail func(error)) {
+	groupFail := func(err error) {
+		fail(errors.Wrap(err, where))
+	}
+	if bp.ID == "" {
+		groupFail(errors.New("buildpack is missing an id"))
+		return
+	}
+	resolved, err := bp.resolve(c.BuildpacksDir)
+	if err != nil {
+		groupFail(err)
+		return
+	}
+	bpFail := func(err error) {
+		groupFail(errors.Wrapf(err, "buildpack %s", resolved.noOpt()))
+	}
+	info, err := resolved.lookup(c.BuildpacksDir)
+	if err != nil {
+		bpFail(errors.Wrap(err, "read buildpack.toml"))
+		return
+	}
+	keys, err := undecodedKeys(filepath.Join(info.Path, "buildpack.toml"))
+	if err != nil {
+		bpFail(errors.Wrap(err, "read buildpack.toml"))
+	}
+	for _, key := range keys {
+		bpFail(errors.Errorf("buildpack.toml: unknown key '%s'", key))
+	}
+	if info.Buildpack.ID != bp.ID {
+		bpFail(errors.Errorf("buildpack.toml declares id '%s'", info.Buildpack.ID))
+	}
+	if info.Buildpack.Version == "" {
+		bpFail(errors.New("buildpack.toml is missing a version"))
+	}
+	if err := info.verifyAPI(c.BuildpackAPI); err != nil {
+		groupFail(err)
+	}
+	if info.Order != nil {
+		next, err := path.expand(resolved)
+		if err != nil {
+			groupFail(err)
+			return
+		}
+		info.Order.validate(next, where+" > "+resolved.noOpt().String()+" ", c, fail)
+		return
+	}
+	for _, name := range []string{"detect", "build"} {
+		if fi, err := os.Stat(filepath.Join(info.Path, "bin", name)); err != nil || fi.IsDir() {
+			bpFail(errors.Errorf("missing executable bin/%s", name))
+		}
+	}
+}
+
+// undecodedKeys returns the keys in buildpack.toml that the lifecycle does not
+// use, other than those allowed by the spec but only used by platforms.
+func undecodedKeys(path string) ([]string, error) {
+	md, err := toml.DecodeFile(path, &buildpackTOML{})
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, key := range md.Undecoded() {
+		if key[0] == "metadata" || key.String() == "buildpack.homepage" {
+			continue
+		}
+		keys = append(keys, key.String())
+	}
+	return keys, nil
+}
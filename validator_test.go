@@ -0,0 +1,95 @@
+package lifecycle_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/lifecycle"
+	"github.com/buildpacks/lifecycle/api"
+)
+
+func TestValidator(t *testing.T) {
+	spec.Run(t, "Validator", testValidator, spec.Report(report.Terminal{}))
+}
+
+func testValidator(t *testing.T, when spec.G, it spec.S) {
+	var config *lifecycle.ValidateConfig
+
+	it.Before(func() {
+		config = &lifecycle.ValidateConfig{
+			BuildpacksDir: filepath.Join("testdata", "by-id"),
+			BuildpackAPI:  api.MustParse("0.2"),
+		}
+	})
+
+	errStrings := func(errs []error) []string {
+		var out []string
+		for _, err := range errs {
+			out = append(out, err.Error())
+		}
+		return out
+	}
+
+	when("#Validate", func() {
+		it("should pass a valid order with meta-buildpacks and version ranges", func() {
+			errs := lifecycle.BuildpackOrder{
+				{Group: []lifecycle.Buildpack{{ID: "E", Version: "v1"}, {ID: "A"}}},
+				{Group: []lifecycle.Buildpack{{ID: "B", Version: "^1"}, {ID: "C", Version: "v2", Optional: true}}},
+			}.Validate(config)
+			if len(errs) != 0 {
+				t.Fatalf("Unexpected errors:\n%s\n", errStrings(errs))
+			}
+		})
+
+		it("should fail unknown keys in buildpack.toml", func() {
+			errs := lifecycle.BuildpackOrder{
+				{Group: []lifecycle.Buildpack{{ID: "O", Version: "v1"}}},
+			}.Validate(config)
+			if s := cmp.Diff(errStrings(errs), []string{
+				"group 1: buildpack O@v1: buildpack.toml: unknown key 'buildpack.clear_env'",
+				"group 1: buildpack O@v1: buildpack.toml: unknown key 'stacks.mixin'",
+			}); s != "" {
+				t.Fatalf("Unexpected errors:\n%s\n", s)
+			}
+		})
+
+		it("should fail an empty order", func() {
+			errs := lifecycle.BuildpackOrder{}.Validate(config)
+			if s := cmp.Diff(errStrings(errs), []string{"order is empty"}); s != "" {
+				t.Fatalf("Unexpected errors:\n%s\n", s)
+			}
+		})
+
+		it("should report every problem found", func() {
+			errs := lifecycle.BuildpackOrder{
+				{Group: []lifecycle.Buildpack{
+					{ID: "Z", Version: "v1"},
+					{ID: "A", Version: "v9"},
+					{ID: "N", Version: "v1"},
+					{ID: "K", Version: "v1"},
+				}},
+				{Group: []lifecycle.Buildpack{}},
+				{Group: []lifecycle.Buildpack{{ID: "B", Version: "v1", Optional: true}}},
+				{Group: []lifecycle.Buildpack{{ID: "H", Version: "v1"}}},
+			}.Validate(config)
+
+			if s := cmp.Diff(errStrings(errs), []string{
+				"group 1: find versions of buildpack Z: open " + filepath.Join("testdata", "by-id", "Z") + ": no such file or directory",
+				"group 1: no version of buildpack A matches 'v9'",
+				"group 1: buildpack N@v1: buildpack.toml declares id 'not-N'",
+				"group 1: buildpack N@v1: missing executable bin/detect",
+				"group 1: buildpack N@v1: missing executable bin/build",
+				"group 1: buildpack K@v1 declares Buildpack API version 0.3 which is incompatible with the lifecycle's Buildpack API version 0.2",
+				"group 2: group is empty",
+				"group 3: group contains only optional buildpacks",
+				"group 4 > H@v1 group 1 > I@v1 group 1 > J@v1 group 1: cyclic buildpack order: H@v1 -> I@v1 -> J@v1 -> H@v1",
+			}); s != "" {
+				t.Fatalf("Unexpected errors:\n%s\n", s)
+			}
+		})
+	})
+}